@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+// DefaultAMQPHeader header carrying the token of AMQP deliveries
+const DefaultAMQPHeader = "Authorization"
+
+// AMQP actions on deliveries without a valid token
+const (
+	// AMQPIgnore skip the delivery, the only action available to auto-ack consumers.
+	// Manual-ack consumers reject the delivery instead so it is not redelivered forever
+	AMQPIgnore AMQPAction = iota
+	// AMQPReject reject without requeue, the broker dead-letter the delivery when
+	// the queue has a dead letter exchange
+	AMQPReject
+	// AMQPRequeue reject and requeue the delivery
+	AMQPRequeue
+)
+
+type (
+	// AMQPAction taken on deliveries failing authentication
+	AMQPAction int
+	// AMQPOptions configure AuthManager.AMQPHandler
+	AMQPOptions struct {
+		// Header carrying the token, default DefaultAMQPHeader. The "Bearer " prefix is optional
+		Header string
+		// OnInvalid action taken on deliveries without a valid token. Reject and
+		// requeue require ManualAck, auto-ack consumers ignore the delivery
+		OnInvalid AMQPAction
+		// ManualAck set when the consumer acknowledge deliveries, e.g. subscribed
+		// with messaging AmqpClient.SubscribeToQueueManualAck
+		ManualAck bool
+		// OnError called with deliveries failing authentication, default log a warning
+		OnError func(d amqp.Delivery, err *AuthError)
+	}
+)
+
+// AMQPHandler wrap a delivery handler so it only receive deliveries carrying a
+// valid token. The handler context hold the same values as Authenticate. With
+// manual acknowledgement next must acknowledge the deliveries it receive
+func (am *AuthManager) AMQPHandler(opts AMQPOptions, next func(ctx context.Context, d amqp.Delivery)) func(amqp.Delivery) {
+	action := opts.OnInvalid
+	switch {
+	case opts.ManualAck && action == AMQPIgnore:
+		action = AMQPReject
+	case !opts.ManualAck && action != AMQPIgnore:
+		logrus.Errorf("auth: OnInvalid %d requires ManualAck, invalid deliveries will be ignored", action)
+		action = AMQPIgnore
+	}
+	return func(d amqp.Delivery) {
+		ctx, err := am.authenticateDelivery(d, opts.Header)
+		if err != nil {
+			if opts.OnError != nil {
+				opts.OnError(d, err)
+			} else {
+				logrus.Warnf("auth: rejecting delivery %d from %q: %v", d.DeliveryTag, d.RoutingKey, err)
+			}
+			var ackErr error
+			switch action {
+			case AMQPReject:
+				ackErr = d.Reject(false)
+			case AMQPRequeue:
+				ackErr = d.Reject(true)
+			}
+			if ackErr != nil {
+				logrus.Errorf("auth: failed to reject delivery %d: %v", d.DeliveryTag, ackErr)
+			}
+			return
+		}
+		next(ctx, d)
+	}
+}
+
+func (am *AuthManager) authenticateDelivery(d amqp.Delivery, header string) (context.Context, *AuthError) {
+	if header == "" {
+		header = DefaultAMQPHeader
+	}
+	var raw string
+	switch v := d.Headers[header].(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	}
+	if len(raw) > 7 && strings.EqualFold(raw[:7], "bearer ") {
+		raw = raw[7:]
+	}
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, errMissingToken()
+	}
+	token, claims, iss, err := am.verify(context.Background(), raw, presentation{})
+	if err != nil {
+		return nil, asAuthError(err)
+	}
+	ctx := context.WithValue(context.Background(), JWTToken, raw)
+	ctx = context.WithValue(ctx, TokenKey, token)
+	return contextWithClaims(ctx, claims, iss.mapping), nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streadway/amqp"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+type testAcknowledger struct {
+	rejected, requeued bool
+}
+
+func (a *testAcknowledger) Ack(tag uint64, multiple bool) error { return nil }
+
+func (a *testAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error { return nil }
+
+func (a *testAcknowledger) Reject(tag uint64, requeue bool) error {
+	a.rejected, a.requeued = true, requeue
+	return nil
+}
+
+func TestAMQPHandler(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{Issuer: defaultIssuer, Audiences: defaultAudience, IdentityServerURI: ts.URL})
+	token := signTestToken(key, defaultTestClaims(), map[string]interface{}{"role": "publisher"})
+
+	var tests = []struct {
+		name         string
+		headers      amqp.Table
+		opts         AMQPOptions
+		wantHandled  bool
+		wantRejected bool
+		wantRequeued bool
+	}{
+		{"bearer header", amqp.Table{"Authorization": "Bearer " + token}, AMQPOptions{}, true, false, false},
+		{"custom header", amqp.Table{"x-token": []byte(token)}, AMQPOptions{Header: "x-token"}, true, false, false},
+		{"missing token ignored", amqp.Table{}, AMQPOptions{}, false, false, false},
+		{"invalid token dead-lettered", amqp.Table{"Authorization": "bad"}, AMQPOptions{OnInvalid: AMQPReject, ManualAck: true}, false, true, false},
+		{"invalid token requeued", amqp.Table{"Authorization": "bad"}, AMQPOptions{OnInvalid: AMQPRequeue, ManualAck: true}, false, true, true},
+		{"manual ack rejected by default", amqp.Table{}, AMQPOptions{ManualAck: true}, false, true, false},
+		{"reject without manual ack ignored", amqp.Table{"Authorization": "bad"}, AMQPOptions{OnInvalid: AMQPRequeue}, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ack := &testAcknowledger{}
+			handled := false
+			var failure *AuthError
+			tt.opts.OnError = func(d amqp.Delivery, err *AuthError) { failure = err }
+			h := am.AMQPHandler(tt.opts, func(ctx context.Context, d amqp.Delivery) {
+				handled = true
+				if GetUserIDFromContext(ctx) != "user-id" {
+					t.Errorf("unexpected user id %q", GetUserIDFromContext(ctx))
+				}
+				if _, ok := GetRolesFromContext(ctx)["publisher"]; !ok {
+					t.Error("expected publisher role")
+				}
+			})
+			h(amqp.Delivery{Acknowledger: ack, Headers: tt.headers})
+			if handled != tt.wantHandled || ack.rejected != tt.wantRejected || ack.requeued != tt.wantRequeued {
+				t.Errorf("unexpected outcome handled=%v rejected=%v requeued=%v", handled, ack.rejected, ack.requeued)
+			}
+			if !tt.wantHandled && failure == nil {
+				t.Error("expected OnError to be called")
+			}
+		})
+	}
+}
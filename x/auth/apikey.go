@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyScheme scheme of API key challenges
+const APIKeyScheme = "APIKey"
+
+var (
+	// ErrInvalidAPIKey returned when the API key is unknown
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrAPIKeyExpired returned when the API key is expired
+	ErrAPIKeyExpired = errors.New("API key is expired")
+)
+
+// APIKeyExtractor default extractor of APIKeyAuthenticator, read "X-API-Key"
+// header then "api_key" query parameter
+var APIKeyExtractor = FromFirst(FromHeader("X-API-Key"), FromQuery("api_key"))
+
+type (
+	// APIKey API key of a machine client, only the hash of the key is stored
+	APIKey struct {
+		ID        string
+		Hash      string
+		Subject   string
+		Roles     []string
+		Scopes    []string
+		Tenant    string
+		ExpiresAt time.Time
+	}
+	// APIKeyStore lookup API keys by hash
+	APIKeyStore interface {
+		// LookupAPIKey return the key with hash, nil when unknown
+		LookupAPIKey(ctx context.Context, hash string) (*APIKey, error)
+	}
+	// MemoryAPIKeyStore in-memory APIKeyStore
+	MemoryAPIKeyStore struct {
+		mu   sync.RWMutex
+		keys map[string]*APIKey
+	}
+	// APIKeyAuthenticator authenticate requests with API keys, populating the
+	// same context values as AuthManager.Authenticate
+	APIKeyAuthenticator struct {
+		Store APIKeyStore
+		// Extractor read raw key from request, default APIKeyExtractor
+		Extractor TokenExtractor
+		// ErrorResponder write auth failures, default WriteError
+		ErrorResponder ErrorResponder
+		// Realm reported in WWW-Authenticate challenges
+		Realm string
+	}
+)
+
+// HashAPIKey return the hash stored for key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateAPIKey return a random key, hand it to the client and store HashAPIKey of it
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewMemoryAPIKeyStore create MemoryAPIKeyStore holding keys
+func NewMemoryAPIKeyStore(keys ...APIKey) *MemoryAPIKeyStore {
+	s := &MemoryAPIKeyStore{keys: map[string]*APIKey{}}
+	for _, k := range keys {
+		s.Add(k)
+	}
+	return s
+}
+
+// Add store key, replacing the key with the same hash
+func (s *MemoryAPIKeyStore) Add(key APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.Hash] = &key
+}
+
+// Remove delete the key with id
+func (s *MemoryAPIKeyStore) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h, k := range s.keys {
+		if k.ID == id {
+			delete(s.keys, h)
+		}
+	}
+}
+
+// LookupAPIKey implements APIKeyStore
+func (s *MemoryAPIKeyStore) LookupAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys[hash], nil
+}
+
+// NewAPIKeyAuthenticator create APIKeyAuthenticator backed by store
+func NewAPIKeyAuthenticator(store APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{Store: store, Extractor: APIKeyExtractor}
+}
+
+// Authenticate middleware reject requests without a valid API key
+func (a *APIKeyAuthenticator) Authenticate() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		hfn := func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := a.authenticate(r)
+			if err != nil {
+				a.responder()(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(hfn)
+	}
+}
+
+func (a *APIKeyAuthenticator) authenticate(r *http.Request) (context.Context, *AuthError) {
+	extractor := a.Extractor
+	if extractor == nil {
+		extractor = APIKeyExtractor
+	}
+	raw, err := extractor.Extract(r)
+	if err == ErrTokenNotFound || (err == nil && raw == "") {
+		return nil, &AuthError{Status: http.StatusUnauthorized, Scheme: APIKeyScheme}
+	}
+	if err != nil {
+		return nil, errInvalidAPIKey(err)
+	}
+	key, err := a.Store.LookupAPIKey(r.Context(), HashAPIKey(raw))
+	if err != nil {
+		return nil, errInvalidAPIKey(err)
+	}
+	if key == nil {
+		return nil, errInvalidAPIKey(ErrInvalidAPIKey)
+	}
+	if !key.ExpiresAt.IsZero() && !time.Now().Before(key.ExpiresAt) {
+		return nil, errInvalidAPIKey(ErrAPIKeyExpired)
+	}
+	ctx := withResponder(r.Context(), a.responder())
+	return contextWithClaims(ctx, key.claims(), claimMapping{}), nil
+}
+
+func (a *APIKeyAuthenticator) responder() ErrorResponder {
+	return realmResponder(a.Realm, a.ErrorResponder)
+}
+
+// claims describe key as token claims so the usual context values are derived from it
+func (k *APIKey) claims() map[string]interface{} {
+	roles := make([]interface{}, 0, len(k.Roles))
+	for _, r := range k.Roles {
+		roles = append(roles, r)
+	}
+	claims := map[string]interface{}{
+		"sub":        k.Subject,
+		"role":       roles,
+		"scope":      strings.Join(k.Scopes, " "),
+		"api_key_id": k.ID,
+	}
+	if k.Tenant != "" {
+		claims["tenant"] = k.Tenant
+	}
+	if !k.ExpiresAt.IsZero() {
+		claims["exp"] = float64(k.ExpiresAt.Unix())
+	}
+	return claims
+}
+
+func errInvalidAPIKey(err error) *AuthError {
+	return &AuthError{Status: http.StatusUnauthorized, Scheme: APIKeyScheme, Code: ErrCodeInvalidToken, Description: describe(err), Err: err}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	valid, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := GenerateAPIKey()
+	store := NewMemoryAPIKeyStore(
+		APIKey{ID: "k1", Hash: HashAPIKey(valid), Subject: "billing-service", Roles: []string{"service"}, Scopes: []string{"invoices:read"}},
+		APIKey{ID: "k2", Hash: HashAPIKey(expired), Subject: "old-service", Roles: []string{"service"}, ExpiresAt: time.Now().Add(-time.Minute)},
+	)
+	a := NewAPIKeyAuthenticator(store)
+	var got *Principal
+	h := a.Authenticate()(RequireRoles("service")(RequireScopes("invoices:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	}))))
+
+	var tests = []struct {
+		name   string
+		header string
+		query  string
+		want   int
+	}{
+		{"header", valid, "", 200},
+		{"query", "", valid, 200},
+		{"missing", "", "", 401},
+		{"unknown", "nope", "", 401},
+		{"expired", expired, "", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			target := "/"
+			if tt.query != "" {
+				target += "?api_key=" + tt.query
+			}
+			req := httptest.NewRequest("GET", target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("unexpected status %d, want %d", rr.Code, tt.want)
+			}
+			if tt.want == 200 && (got == nil || got.Subject != "billing-service") {
+				t.Errorf("unexpected principal %+v", got)
+			}
+			if challenge := rr.Header().Get("WWW-Authenticate"); tt.want == 401 && (!strings.HasPrefix(challenge, APIKeyScheme) || strings.Contains(challenge, "error=")) {
+				t.Errorf("unexpected challenge %q", rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	store.Remove("k1")
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-API-Key", valid)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != 401 {
+		t.Errorf("expected removed key to be rejected, got %d", rr.Code)
+	}
+}
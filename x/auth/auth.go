@@ -2,40 +2,112 @@ package auth
 
 import (
 	"context"
+	"crypto/x509"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/flyznex/gois"
+	"github.com/sirupsen/logrus"
 	jose "gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
 )
 
-//AuthModel auth model context
+// AuthModel auth model context
 type (
 	AuthModel struct {
 		Options         gois.JWKClientOptions
 		Audience        []string
 		Issuer          string
 		MethodSignature jose.SignatureAlgorithm
+		RoleClaims      []string
+		RoleHierarchy   *RoleHierarchy
+		TenantClaim     string
+		Realm           string
+		// Offline verification keys, see ConfigAuth. Options is ignored when one is
+		// set, an empty MethodSignature then accept the algorithms of the keys
+		PublicKeysPEM string
+		JWKSFile      string
+		HMACSecret    string
+		// Time and presence rules of claims, see ConfigAuth
+		Leeway         time.Duration
+		MaxAge         time.Duration
+		RequiredClaims []string
+		Clock          func() time.Time
+		// ErrorResponder write auth failures, default WriteError
+		ErrorResponder ErrorResponder
 	}
 	ConfigAuth struct {
 		Issuer            string
 		Audiences         []string
 		IdentityServerURI string
 		MethodSignature   string
+		// RoleClaims claim paths merged into roles, default "role".
+		// Nested claims use dot path (realm_access.roles), namespaced
+		// claims can be used as-is (https://example.com/roles)
+		RoleClaims []string
+		// RoleHierarchy expand roles read from claims with the roles they imply
+		RoleHierarchy *RoleHierarchy
+		// TenantClaim claim path of the tenant exposed by Principal, default "tenant"
+		TenantClaim string
+		// Realm reported in WWW-Authenticate challenges
+		Realm string
+		// DiscoveryRefresh interval OpenID provider metadata is refreshed, used when
+		// IdentityServerURI is not set and keys are discovered from Issuer
+		DiscoveryRefresh time.Duration
+		// JWKS cache settings, see JWKSOptions
+		JWKSCacheTTL           time.Duration
+		JWKSRefreshInterval    time.Duration
+		JWKSMinRefetchInterval time.Duration
+		OnJWKSFetch            func(JWKSFetchEvent)
+		// Offline verification, IdentityServerURI is ignored when one is set.
+		// PublicKeysPEM hold PUBLIC KEY, RSA PUBLIC KEY or CERTIFICATE blocks,
+		// JWKSFile is the path of a local JWKS, HMACSecret a HS256/HS384/HS512 secret
+		PublicKeysPEM string
+		JWKSFile      string
+		HMACSecret    string
+		// Leeway tolerated clock skew on exp, nbf and iat, default one minute,
+		// negative for none
+		Leeway time.Duration
+		// MaxAge reject tokens issued (iat) longer ago, tokens without iat are
+		// rejected when set
+		MaxAge time.Duration
+		// RequiredClaims claims tokens must carry, e.g. sub, jti. nbf is always
+		// enforced when present, require it to reject tokens without nbf
+		RequiredClaims []string
+		// Clock return current time, default time.Now
+		Clock func() time.Time
 	}
 	AuthManager struct {
+		// Validator verify tokens of managers built as a literal, constructors set
+		// it to the validator of the first issuer
 		Validator *gois.JWTValidator
+		// Extractor read raw token from request, default BearerExtractor
+		Extractor TokenExtractor
+		// ErrorResponder write auth failures, default WriteError
+		ErrorResponder ErrorResponder
+		// Revocations checked on jti and sub of validated tokens, disabled when nil
+		Revocations RevocationStore
+		// DPoP accept "DPoP" authorization scheme and verify proofs, disabled when nil.
+		// Entry points which cannot carry a proof (gRPC, AMQP) reject DPoP-bound tokens
+		DPoP *DPoPVerifier
+		// RequireCertificateBinding reject tokens without cnf "x5t#S256" claim. Bound
+		// tokens must always match the client certificate of the mTLS connection
+		// (RFC 8705), AMQP deliveries carry no certificate and are rejected
+		RequireCertificateBinding bool
+
+		issuers []*issuer
+		realm   string
 	}
 )
 type contextKey struct {
 	name string
 }
 
-//New new AuthModel with default method RS256
+// New new AuthModel with default method RS256, static keys default to the
+// algorithms of the keys
 func New(cfg ConfigAuth) *AuthModel {
 	m := jose.RS256
-	if cfg.MethodSignature != "" {
+	if cfg.MethodSignature != "" || cfg.PublicKeysPEM != "" || cfg.JWKSFile != "" || cfg.HMACSecret != "" {
 		m = jose.SignatureAlgorithm(cfg.MethodSignature)
 	}
 	return &AuthModel{
@@ -43,58 +115,183 @@ func New(cfg ConfigAuth) *AuthModel {
 		Issuer:          cfg.Issuer,
 		Options:         gois.JWKClientOptions{URI: cfg.IdentityServerURI},
 		MethodSignature: m,
+		RoleClaims:      cfg.RoleClaims,
+		RoleHierarchy:   cfg.RoleHierarchy,
+		TenantClaim:     cfg.TenantClaim,
+		Realm:           cfg.Realm,
+		PublicKeysPEM:   cfg.PublicKeysPEM,
+		JWKSFile:        cfg.JWKSFile,
+		HMACSecret:      cfg.HMACSecret,
+		Leeway:          cfg.Leeway,
+		MaxAge:          cfg.MaxAge,
+		RequiredClaims:  cfg.RequiredClaims,
+		Clock:           cfg.Clock,
 	}
 }
 
 // NewAuthManager create new AuthManager instance
 func NewAuthManager(cfg ConfigAuth) *AuthManager {
-	m := jose.RS256
-	if cfg.MethodSignature != "" {
-		m = jose.SignatureAlgorithm(cfg.MethodSignature)
+	am := &AuthManager{
+		Extractor: BearerExtractor,
+		realm:     cfg.Realm,
 	}
-	authClient := gois.NewJWKClient(gois.JWKClientOptions{URI: cfg.IdentityServerURI}, nil)
-	configuration := gois.NewConfiguration(authClient, cfg.Audiences, cfg.Issuer, m)
-	validator := gois.NewValidator(configuration, nil)
-	return &AuthManager{
-		Validator: validator,
+	extractor := gois.RequestTokenExtractorFunc(am.extractToken)
+	iss, err := newIssuer(cfg, extractor)
+	if err != nil {
+		logrus.Errorf("auth: invalid config for issuer %q, all tokens will be rejected: %v", cfg.Issuer, err)
+		iss = brokenIssuer(cfg, extractor, err)
 	}
+	am.issuers = []*issuer{iss}
+	am.Validator = iss.validator
+	return am
 }
 
 func (am *AuthManager) Authenticate() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		hfn := func(w http.ResponseWriter, r *http.Request) {
-			raw := ""
-			if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[0:7], "BEARER ") {
-				raw = h[7:]
-			}
-			if raw == "" {
-				http.Error(w, http.StatusText(401), 401)
+			ctx, err := am.authenticate(r)
+			if err != nil {
+				am.responder()(w, r, err)
 				return
 			}
-			ctx := context.WithValue(r.Context(), JWTToken, raw)
-			token, err := am.Validator.ValidateRequest(r)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(hfn)
+	}
+}
+
+// AuthenticateOptional like Authenticate but let requests without credentials pass through
+// untouched. Requests carrying a malformed or invalid token, or an Authorization header
+// without a token, are still rejected
+func (am *AuthManager) AuthenticateOptional() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		hfn := func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := am.authenticate(r)
+			if err != nil && err.Code == "" {
+				if r.Header.Get("Authorization") == "" {
+					next.ServeHTTP(w, r)
+					return
+				}
+				err = errInvalidRequest("malformed authorization header")
+			}
 			if err != nil {
-				http.Error(w, http.StatusText(401), 401)
+				am.responder()(w, r, err)
 				return
 			}
-			ctx = context.WithValue(ctx, TokenKey, token)
-			ctx = buildContextWithValue(ctx, am, token)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 		return http.HandlerFunc(hfn)
 	}
 }
-func buildContextWithValue(ctx context.Context, am *AuthManager, token *jwt.JSONWebToken) context.Context {
+
+// authenticate validate token carried by request and return context populated with its claims
+func (am *AuthManager) authenticate(r *http.Request) (context.Context, *AuthError) {
+	raw, err := am.extractor().Extract(r)
+	dpop := false
+	if am.DPoP != nil {
+		if t, derr := DPoPExtractor.Extract(r); derr == nil {
+			raw, err, dpop = t, nil, true
+		}
+	}
+	if err == ErrTokenNotFound || (err == nil && raw == "") {
+		return nil, errMissingToken()
+	}
+	if err != nil {
+		return nil, errInvalidToken(err)
+	}
+	p := presentation{cert: peerCertificate(r.TLS)}
+	if dpop {
+		p.dpop = r
+	}
+	token, claims, iss, err := am.verify(r.Context(), raw, p)
+	if err != nil {
+		return nil, asAuthError(err)
+	}
+	ctx := withResponder(r.Context(), am.responder())
+	ctx = context.WithValue(ctx, JWTToken, raw)
+	ctx = context.WithValue(ctx, TokenKey, token)
+	ctx = contextWithClaims(ctx, claims, iss.mapping)
+	return ctx, nil
+}
+
+// presentation connection a token was presented on, checked against its confirmation claims
+type presentation struct {
+	// dpop request carrying a DPoP proof, nil when the token was presented as bearer
+	dpop *http.Request
+	// cert client certificate of the connection, nil without mTLS
+	cert *x509.Certificate
+}
+
+// verify validate raw token presented on p and return it with its claims and the
+// issuer which validated it
+func (am *AuthManager) verify(ctx context.Context, raw string, p presentation) (*jwt.JSONWebToken, map[string]interface{}, *issuer, error) {
+	token, err := jwt.ParseSigned(raw)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	iss, err := am.issuerFor(token)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := iss.validate(ctx, token); err != nil {
+		return nil, nil, nil, err
+	}
 	claims := map[string]interface{}{}
-	err := am.Validator.Claims(token, &claims)
+	if err := iss.validator.Claims(token, &claims); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := iss.temporal.validate(claims); err != nil {
+		return nil, nil, nil, err
+	}
+	if am.Revocations != nil {
+		if err := checkRevoked(am.Revocations, claims); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if am.DPoP != nil {
+		if err := am.DPoP.Verify(p.dpop, raw, claims, p.dpop != nil); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if err := verifyCertificateBinding(p.cert, claims, am.RequireCertificateBinding); err != nil {
+		return nil, nil, nil, err
+	}
+	return token, claims, iss, nil
+}
+
+func (am *AuthManager) responder() ErrorResponder {
+	return realmResponder(am.realm, am.ErrorResponder)
+}
+
+func (am *AuthManager) extractor() TokenExtractor {
+	if am.Extractor == nil {
+		return BearerExtractor
+	}
+	return am.Extractor
+}
+
+// extractToken adapt Extractor for gois validator so ValidateRequest read the same token
+func (am *AuthManager) extractToken(r *http.Request) (*jwt.JSONWebToken, error) {
+	raw, err := am.extractor().Extract(r)
+	if err == ErrTokenNotFound {
+		return nil, gois.ErrTokenNotFound
+	}
 	if err != nil {
-		return ctx
+		return nil, err
 	}
+	return jwt.ParseSigned(raw)
+}
+
+// contextWithClaims store identity, principal, roles, scopes and user id of claims in context
+func contextWithClaims(ctx context.Context, claims map[string]interface{}, m claimMapping) context.Context {
 	ctx = context.WithValue(ctx, IdentityKey, claims)
-	roles := getRoleFromClaims(claims)
+	roles := m.roles(claims)
 	ctx = context.WithValue(ctx, RolesKey, roles)
+	scopes := getScopesFromClaims(claims)
+	ctx = context.WithValue(ctx, ScopesKey, scopes)
 	userID := getUserIDFromClaims(claims)
 	ctx = context.WithValue(ctx, UserIDKey, userID)
+	ctx = context.WithValue(ctx, PrincipalKey, newPrincipal(claims, roles, scopes, m))
 	return ctx
 }
 
@@ -105,34 +302,46 @@ var (
 	IdentityKey = &contextKey{"Identity"}
 	UserIDKey   = &contextKey{"UserID"}
 	RolesKey    = &contextKey{"Roles"}
+	ScopesKey   = &contextKey{"Scopes"}
+	// PrincipalKey hold *Principal, read it with PrincipalFromContext
+	PrincipalKey = &contextKey{"Principal"}
+	// TenantKey hold tenant of the request, read it with TenantFromContext
+	TenantKey = &contextKey{"Tenant"}
+	// SchemeKey hold the scheme which authenticated the request, read it with SchemeFromContext
+	SchemeKey = &contextKey{"Scheme"}
 )
 
-//Authenticator middleware
+// Authenticator middleware
 func Authenticator(auth *AuthModel) func(http.Handler) http.Handler {
-	authClient := gois.NewJWKClient(auth.Options, nil)
-	configuration := gois.NewConfiguration(authClient, auth.Audience, auth.Issuer, auth.MethodSignature)
-	validator := gois.NewValidator(configuration, nil)
+	iss := auth.issuer()
+	responder := realmResponder(auth.Realm, auth.ErrorResponder)
 	return func(next http.Handler) http.Handler {
 		hfn := func(w http.ResponseWriter, r *http.Request) {
-			token, err := validator.ValidateRequest(r)
+			token, err := gois.FromHeader(r)
+			if err == gois.ErrTokenNotFound {
+				responder(w, r, errMissingToken())
+				return
+			}
+			if err == nil {
+				err = iss.validate(r.Context(), token)
+			}
 			if err != nil {
-				http.Error(w, http.StatusText(401), 401)
+				responder(w, r, errInvalidToken(err))
 				return
 			}
-			ctx := r.Context()
+			ctx := withResponder(r.Context(), responder)
 			//ctx = NewContext(ctx, token, err)
 			ctx = context.WithValue(ctx, TokenKey, token)
 			claims := map[string]interface{}{}
-			err = validator.Claims(token, &claims)
+			err = iss.validator.Claims(token, &claims)
+			if err == nil {
+				err = iss.temporal.validate(claims)
+			}
 			if err != nil {
-				http.Error(w, http.StatusText(401), 401)
+				responder(w, r, errInvalidToken(err))
 				return
 			}
-			ctx = context.WithValue(ctx, IdentityKey, claims)
-			roles := getRoleFromClaims(claims)
-			ctx = context.WithValue(ctx, RolesKey, roles)
-			userID := getUserIDFromClaims(claims)
-			ctx = context.WithValue(ctx, UserIDKey, userID)
+			ctx = contextWithClaims(ctx, claims, iss.mapping)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 		return http.HandlerFunc(hfn)
@@ -143,7 +352,11 @@ func RequireRoles(roles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
-			userRoles := ctx.Value(RolesKey).(map[string]string)
+			userRoles, ok := ctx.Value(RolesKey).(map[string]string)
+			if !ok {
+				respond(w, r, errMissingToken())
+				return
+			}
 			access := false
 			for _, rr := range roles {
 				_, ok := userRoles[rr]
@@ -155,7 +368,7 @@ func RequireRoles(roles ...string) func(http.Handler) http.Handler {
 			if access {
 				next.ServeHTTP(w, r.WithContext(ctx))
 			} else {
-				http.Error(w, http.StatusText(401), 401)
+				respond(w, r, errInsufficientScope("missing required role"))
 				return
 			}
 
@@ -163,49 +376,68 @@ func RequireRoles(roles ...string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireAllRoles allow request when token has every one of the given roles
+func RequireAllRoles(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userRoles, ok := r.Context().Value(RolesKey).(map[string]string)
+			if !ok {
+				respond(w, r, errMissingToken())
+				return
+			}
+			for _, rr := range roles {
+				if _, ok := userRoles[rr]; !ok {
+					respond(w, r, errInsufficientScope("missing required role"))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func GetUserNameFromContext(ctx context.Context) string {
-	claimsCtx := ctx.Value(IdentityKey)
-	if claimsCtx == nil {
+	claims, ok := ctx.Value(IdentityKey).(map[string]interface{})
+	if !ok {
 		return ""
 	}
-	claims := claimsCtx.(map[string]interface{})
-	name, ok := claims["name"]
+	name, _ := claims["name"].(string)
+	return name
+}
+
+// GetRolesFromContext return roles of the authenticated token
+func GetRolesFromContext(ctx context.Context) map[string]string {
+	roles, ok := ctx.Value(RolesKey).(map[string]string)
 	if !ok {
-		return ""
+		return map[string]string{}
 	}
-	return name.(string)
+	return roles
 }
 
 func GetUserIDFromContext(ctx context.Context) string {
-	userId := ctx.Value(UserIDKey)
-	if userId == nil {
-		return ""
-	}
-	return userId.(string)
+	userId, _ := ctx.Value(UserIDKey).(string)
+	return userId
 }
 
 // internal functions
 func getUserIDFromClaims(claims map[string]interface{}) string {
-	sub, ok := claims["sub"]
-	if !ok {
-		return ""
-	}
-	return sub.(string)
+	sub, _ := claims["sub"].(string)
+	return sub
 }
 
-func getRoleFromClaims(claims map[string]interface{}) map[string]string {
+func getRoleFromClaims(claims map[string]interface{}, paths []string) map[string]string {
+	if len(paths) == 0 {
+		paths = defaultRoleClaims
+	}
 	roles := map[string]string{}
-	if rc, ok := claims["role"]; ok {
-		switch v := rc.(type) {
-		case string:
-			roles[v] = v
-		case []interface{}:
-			for _, r := range v {
-				rs := r.(string)
-				roles[rs] = rs
-			}
+	for _, p := range paths {
+		rc, ok := lookupClaim(claims, p)
+		if !ok {
+			continue
+		}
+		for _, r := range claimStrings(rc) {
+			roles[r] = r
 		}
-
 	}
 	return roles
 }
@@ -264,7 +264,105 @@ func TestMiddlewareHandleWithTokenNoValidRole(t *testing.T) {
 		t.Error(err)
 		t.FailNow()
 	}
-	if resp.StatusCode != 401 {
+	if resp.StatusCode != 403 {
 		t.Errorf("unexpected status %d", resp.StatusCode)
 	}
 }
+
+// newTestJWKSServer serve public part of the given keys as JWKS
+func newTestJWKSServer(keys ...jose.JSONWebKey) *httptest.Server {
+	jwks := auth0.JWKS{}
+	for _, k := range keys {
+		jwks.Keys = append(jwks.Keys, k.Public())
+	}
+	value, _ := json.Marshal(&jwks)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Write(value)
+	}))
+}
+
+// signTestToken sign claims with key, kid header taken from the key
+func signTestToken(key jose.JSONWebKey, claims ...interface{}) string {
+	opts := (&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", key.KeyID)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key}, opts)
+	if err != nil {
+		panic(err)
+	}
+	builder := jwt.Signed(signer)
+	for _, c := range claims {
+		builder = builder.Claims(c)
+	}
+	raw, err := builder.CompactSerialize()
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
+
+// defaultTestClaims valid claims for defaultIssuer and defaultAudience
+func defaultTestClaims() jwt.Claims {
+	return jwt.Claims{
+		Issuer:   defaultIssuer,
+		Audience: defaultAudience,
+		Subject:  "user-id",
+		IssuedAt: jwt.NewNumericDate(time.Now()),
+		Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+// serveWithToken serve a GET request carrying bearer token and return the status
+func serveWithToken(h http.Handler, token string) int {
+	req := httptest.NewRequest("GET", "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func TestAuthenticateOptional(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{
+		Issuer:            defaultIssuer,
+		Audiences:         defaultAudience,
+		IdentityServerURI: ts.URL,
+	})
+	h := am.AuthenticateOptional()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUserIDFromContext(r.Context())))
+	}))
+	var tests = []struct {
+		name          string
+		authorization string
+		status        int
+		body          string
+	}{
+		{"anonymous", "", 200, ""},
+		{"valid", "Bearer " + signTestToken(key, defaultTestClaims()), 200, "user-id"},
+		{"invalid", "Bearer " + signTestToken(genRSASSAJWK(jose.RS256, "key"), defaultTestClaims()), 401, "Unauthorized\n"},
+		{"malformed", "Bearer not-a-jwt", 401, "Unauthorized\n"},
+		{"bearer without token", "Bearer ", 400, "Bad Request\n"},
+		{"other scheme", "Basic YWxpY2U6c2VjcmV0", 400, "Bad Request\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("unexpected status %d", rr.Code)
+			}
+			if rr.Body.String() != tt.body {
+				t.Errorf("unexpected body %q", rr.Body.String())
+			}
+		})
+	}
+}
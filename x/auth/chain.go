@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// BasicScheme scheme of HTTP Basic challenges
+const BasicScheme = "Basic"
+
+// ErrInvalidCredentials returned by BasicAuthenticator.Verify for wrong credentials
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+type (
+	// RequestAuthenticator authenticate a request with a single scheme. The
+	// returned error has no Code when the request carry no credentials of the scheme
+	RequestAuthenticator interface {
+		Scheme() string
+		AuthenticateRequest(r *http.Request) (context.Context, *AuthError)
+	}
+	// AuthChain try authenticators in order, the first one succeeding wins
+	AuthChain struct {
+		Authenticators []RequestAuthenticator
+		// ErrorResponder write auth failures, default WriteError
+		ErrorResponder ErrorResponder
+	}
+	// BasicAuthenticator authenticate HTTP Basic credentials
+	BasicAuthenticator struct {
+		// Verify return claims of the user, ErrInvalidCredentials when credentials are wrong
+		Verify func(ctx context.Context, username, password string) (map[string]interface{}, error)
+		// Realm reported in WWW-Authenticate challenges
+		Realm string
+	}
+)
+
+// NewAuthChain create AuthChain
+func NewAuthChain(authenticators ...RequestAuthenticator) *AuthChain {
+	return &AuthChain{Authenticators: authenticators}
+}
+
+// Authenticate middleware reject requests no authenticator accept, the challenges
+// of every scheme are returned
+func (c *AuthChain) Authenticate() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		hfn := func(w http.ResponseWriter, r *http.Request) {
+			var failures []*AuthError
+			for _, a := range c.Authenticators {
+				ctx, err := a.AuthenticateRequest(r)
+				if err == nil {
+					ctx = context.WithValue(ctx, SchemeKey, a.Scheme())
+					if c.ErrorResponder != nil {
+						ctx = withResponder(ctx, c.ErrorResponder)
+					}
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+				failures = append(failures, err)
+			}
+			responder := c.ErrorResponder
+			if responder == nil {
+				responder = WriteError
+			}
+			responder(w, r, combineErrors(failures))
+		}
+		return http.HandlerFunc(hfn)
+	}
+}
+
+// combineErrors return the first error of a scheme the request carried
+// credentials for, with the others as alternatives
+func combineErrors(failures []*AuthError) *AuthError {
+	if len(failures) == 0 {
+		return errMissingToken()
+	}
+	first := 0
+	for i, f := range failures {
+		if f.Code != "" {
+			first = i
+			break
+		}
+	}
+	err := failures[first]
+	for i, f := range failures {
+		if i != first {
+			err.Alternatives = append(err.Alternatives, f)
+		}
+	}
+	return err
+}
+
+// SchemeFromContext return the scheme which authenticated the request
+func SchemeFromContext(ctx context.Context) string {
+	scheme, _ := ctx.Value(SchemeKey).(string)
+	return scheme
+}
+
+// Scheme implements RequestAuthenticator
+func (am *AuthManager) Scheme() string {
+	return "Bearer"
+}
+
+// AuthenticateRequest implements RequestAuthenticator
+func (am *AuthManager) AuthenticateRequest(r *http.Request) (context.Context, *AuthError) {
+	ctx, err := am.authenticate(r)
+	if err != nil && err.Realm == "" {
+		err.Realm = am.realm
+	}
+	return ctx, err
+}
+
+// Scheme implements RequestAuthenticator
+func (in *Introspector) Scheme() string {
+	return "Bearer"
+}
+
+// AuthenticateRequest implements RequestAuthenticator
+func (in *Introspector) AuthenticateRequest(r *http.Request) (context.Context, *AuthError) {
+	ctx, err := in.authenticate(r)
+	if err != nil && err.Realm == "" {
+		err.Realm = in.cfg.Realm
+	}
+	return ctx, err
+}
+
+// Scheme implements RequestAuthenticator
+func (a *APIKeyAuthenticator) Scheme() string {
+	return APIKeyScheme
+}
+
+// AuthenticateRequest implements RequestAuthenticator
+func (a *APIKeyAuthenticator) AuthenticateRequest(r *http.Request) (context.Context, *AuthError) {
+	ctx, err := a.authenticate(r)
+	if err != nil && err.Realm == "" {
+		err.Realm = a.Realm
+	}
+	return ctx, err
+}
+
+// Scheme implements RequestAuthenticator
+func (b *BasicAuthenticator) Scheme() string {
+	return BasicScheme
+}
+
+// AuthenticateRequest implements RequestAuthenticator
+func (b *BasicAuthenticator) AuthenticateRequest(r *http.Request) (context.Context, *AuthError) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, &AuthError{Status: http.StatusUnauthorized, Scheme: BasicScheme, Realm: b.Realm}
+	}
+	claims, err := b.Verify(r.Context(), username, password)
+	if err != nil {
+		return nil, &AuthError{Status: http.StatusUnauthorized, Scheme: BasicScheme, Realm: b.Realm, Code: ErrCodeInvalidToken, Description: describe(err), Err: err}
+	}
+	if claims == nil {
+		claims = map[string]interface{}{}
+	}
+	if _, ok := claims["sub"]; !ok {
+		claims["sub"] = username
+	}
+	ctx := withResponder(r.Context(), realmResponder(b.Realm, nil))
+	return contextWithClaims(ctx, claims, claimMapping{}), nil
+}
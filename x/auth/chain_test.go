@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestAuthChain(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{Issuer: defaultIssuer, Audiences: defaultAudience, IdentityServerURI: ts.URL, Realm: "api"})
+	apiKey, _ := GenerateAPIKey()
+	keys := NewAPIKeyAuthenticator(NewMemoryAPIKeyStore(APIKey{ID: "k", Hash: HashAPIKey(apiKey), Subject: "machine", Roles: []string{"admin"}}))
+	basic := &BasicAuthenticator{Realm: "api", Verify: func(ctx context.Context, username, password string) (map[string]interface{}, error) {
+		if username != "alice" || password != "secret" {
+			return nil, ErrInvalidCredentials
+		}
+		return map[string]interface{}{"role": "admin"}, nil
+	}}
+	chain := NewAuthChain(am, keys, basic)
+
+	var scheme, user string
+	h := chain.Authenticate()(RequireRoles("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, user = SchemeFromContext(r.Context()), GetUserIDFromContext(r.Context())
+	})))
+	jwtAdmin := signTestToken(key, defaultTestClaims(), map[string]interface{}{"role": "admin"})
+	jwtUser := signTestToken(key, defaultTestClaims())
+
+	var tests = []struct {
+		name       string
+		setup      func(r *http.Request)
+		want       int
+		wantScheme string
+		wantUser   string
+		challenges []string
+	}{
+		{"jwt", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+jwtAdmin) }, 200, "Bearer", "user-id", nil},
+		{"api key", func(r *http.Request) { r.Header.Set("X-API-Key", apiKey) }, 200, APIKeyScheme, "machine", nil},
+		{"basic", func(r *http.Request) { r.SetBasicAuth("alice", "secret") }, 200, BasicScheme, "alice", nil},
+		{"no credentials", func(r *http.Request) {}, 401, "", "", []string{`Bearer realm="api"`, "APIKey", `Basic realm="api"`}},
+		{"wrong password", func(r *http.Request) { r.SetBasicAuth("alice", "nope") }, 401, "", "", []string{`Basic realm="api"`, `Bearer realm="api"`, "APIKey"}},
+		{"authorization uses authenticated scheme", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+jwtUser) }, 403, "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme, user = "", ""
+			req := httptest.NewRequest("GET", "/", nil)
+			tt.setup(req)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("unexpected status %d, want %d", rr.Code, tt.want)
+			}
+			if scheme != tt.wantScheme || user != tt.wantUser {
+				t.Errorf("unexpected scheme %q user %q", scheme, user)
+			}
+			got := rr.Header().Values("WWW-Authenticate")
+			if tt.challenges != nil && len(got) != len(tt.challenges) {
+				t.Fatalf("unexpected challenges %q", got)
+			}
+			for i, c := range tt.challenges {
+				if !strings.HasPrefix(got[i], c) {
+					t.Errorf("unexpected challenge %q, want prefix %q", got[i], c)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import "strings"
+
+// defaultRoleClaims used when ConfigAuth.RoleClaims not set
+var defaultRoleClaims = []string{"role"}
+
+// defaultTenantClaim used when ConfigAuth.TenantClaim not set
+const defaultTenantClaim = "tenant"
+
+// claimMapping locate roles and tenant in claims
+type claimMapping struct {
+	roleClaims  []string
+	tenantClaim string
+	hierarchy   *RoleHierarchy
+}
+
+func (m claimMapping) roles(claims map[string]interface{}) map[string]string {
+	return m.hierarchy.expand(getRoleFromClaims(claims, m.roleClaims))
+}
+
+func (m claimMapping) tenant(claims map[string]interface{}) string {
+	path := m.tenantClaim
+	if path == "" {
+		path = defaultTenantClaim
+	}
+	v, _ := lookupClaim(claims, path)
+	tenant, _ := v.(string)
+	return tenant
+}
+
+// lookupClaim resolve a claim by path. Path segments are separated by dots,
+// the longest key matching at each level wins so namespaced claims
+// like "https://example.com/roles" can be used as-is.
+func lookupClaim(claims map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := claims[path]; ok {
+		return v, true
+	}
+	for i := strings.LastIndex(path, "."); i > 0; i = strings.LastIndex(path[:i], ".") {
+		sub, ok := claims[path[:i]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if v, ok := lookupClaim(sub, path[i+1:]); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// claimStrings return string values of a claim in string or array form
+func claimStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, s := range v {
+			if ss, ok := s.(string); ok {
+				values = append(values, ss)
+			}
+		}
+		return values
+	}
+	return nil
+}
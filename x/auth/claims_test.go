@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGetRoleFromClaimPaths(t *testing.T) {
+	raw := `{
+		"role": "user",
+		"roles": ["azure-role"],
+		"realm_access": {"roles": ["realm-admin"]},
+		"resource_access": {"my.client": {"roles": ["client-editor"]}},
+		"https://example.com/roles": ["namespaced"]
+	}`
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(raw), &claims); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		paths []string
+		want  []string
+	}{
+		{nil, []string{"user"}},
+		{[]string{"roles"}, []string{"azure-role"}},
+		{[]string{"realm_access.roles"}, []string{"realm-admin"}},
+		{[]string{"resource_access.my.client.roles"}, []string{"client-editor"}},
+		{[]string{"https://example.com/roles", "role"}, []string{"namespaced", "user"}},
+		{[]string{"missing.path"}, []string{}},
+	}
+	for _, tt := range tests {
+		roles := getRoleFromClaims(claims, tt.paths)
+		if len(roles) != len(tt.want) {
+			t.Errorf("paths %v: unexpected roles %v", tt.paths, roles)
+			continue
+		}
+		for _, r := range tt.want {
+			if _, ok := roles[r]; !ok {
+				t.Errorf("paths %v: expected role %q in %v", tt.paths, r, roles)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultEarlyRefresh time before expiry a cached token is renewed
+const DefaultEarlyRefresh = 30 * time.Second
+
+type (
+	// Token access token obtained for outgoing requests
+	Token struct {
+		AccessToken string
+		TokenType   string
+		Expiry      time.Time
+	}
+	// TokenSource supply access tokens for outgoing requests
+	TokenSource interface {
+		// Token return a valid token, cached when possible
+		Token(ctx context.Context) (*Token, error)
+		// Refresh discard the cached token and fetch a new one
+		Refresh(ctx context.Context) (*Token, error)
+	}
+	// ClientCredentialsConfig configure OAuth2 client credentials grant
+	ClientCredentialsConfig struct {
+		TokenURL     string
+		ClientID     string
+		ClientSecret string
+		Scopes       []string
+		// Audience requested, needed by some providers like Auth0
+		Audience string
+		// EndpointParams extra parameters sent to the token endpoint
+		EndpointParams url.Values
+		// EarlyRefresh renew token this long before expiry, default DefaultEarlyRefresh
+		EarlyRefresh time.Duration
+		// Client calling the token endpoint, default time out after DefaultHTTPTimeout
+		Client *http.Client
+	}
+	// ClientCredentialsSource TokenSource using the client credentials grant
+	ClientCredentialsSource struct {
+		cfg ClientCredentialsConfig
+
+		mu    sync.Mutex
+		token *Token
+	}
+	// Transport RoundTripper adding a bearer token of Source to requests,
+	// a request rejected with 401 is retried once with a refreshed token
+	Transport struct {
+		Source TokenSource
+		// Base transport, default http.DefaultTransport
+		Base http.RoundTripper
+	}
+)
+
+// NewClientCredentialsSource create ClientCredentialsSource
+func NewClientCredentialsSource(cfg ClientCredentialsConfig) *ClientCredentialsSource {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultHTTPTimeout}
+	}
+	if cfg.EarlyRefresh <= 0 {
+		cfg.EarlyRefresh = DefaultEarlyRefresh
+	}
+	return &ClientCredentialsSource{cfg: cfg}
+}
+
+// Token return cached token, fetching a new one when missing or about to expire
+func (s *ClientCredentialsSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil && (s.token.Expiry.IsZero() || time.Now().Add(s.cfg.EarlyRefresh).Before(s.token.Expiry)) {
+		return s.token, nil
+	}
+	return s.fetch(ctx)
+}
+
+// Refresh fetch a new token
+func (s *ClientCredentialsSource) Refresh(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetch(ctx)
+}
+
+func (s *ClientCredentialsSource) fetch(ctx context.Context) (*Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	for k, v := range s.cfg.EndpointParams {
+		form[k] = v
+	}
+	if len(s.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	}
+	if s.cfg.Audience != "" {
+		form.Set("audience", s.cfg.Audience)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("client credentials: status %d %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+	if body.AccessToken == "" {
+		return nil, fmt.Errorf("client credentials: no access_token in response")
+	}
+	token := &Token{AccessToken: body.AccessToken, TokenType: body.TokenType}
+	if body.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	s.token = token
+	return token, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base().RoundTrip(withBearer(req, token.AccessToken))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// retry once when the request body can be replayed
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	token, err = t.Source.Refresh(req.Context())
+	if err != nil {
+		return resp, nil
+	}
+	retry := withBearer(req, token.AccessToken)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+	return t.base().RoundTrip(retry)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// withBearer clone request with bearer Authorization header, RoundTrippers must not modify the original
+func withBearer(req *http.Request, token string) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientCredentialsTransport(t *testing.T) {
+	issued := 0
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" || r.PostFormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		if r.PostFormValue("scope") != "read write" {
+			t.Errorf("unexpected scope %q", r.PostFormValue("scope"))
+		}
+		issued++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", issued),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer idp.Close()
+
+	// the first token is revoked by the API
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body := new(strings.Builder)
+		fmt.Fprintf(body, "%s ", r.Header.Get("Authorization"))
+		if r.Body != nil {
+			var payload map[string]string
+			json.NewDecoder(r.Body).Decode(&payload)
+			body.WriteString(payload["msg"])
+		}
+		w.Write([]byte(body.String()))
+	}))
+	defer api.Close()
+
+	source := NewClientCredentialsSource(ClientCredentialsConfig{
+		TokenURL:     idp.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+	})
+	client := &http.Client{Transport: &Transport{Source: source}}
+
+	resp, err := client.Post(api.URL, "application/json", strings.NewReader(`{"msg":"hello"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	if got := string(body); got != "Bearer token-2 hello" {
+		t.Errorf("expected retried request with replayed body, got %q", got)
+	}
+	if _, err := client.Get(api.URL); err != nil {
+		t.Fatal(err)
+	}
+	if issued != 2 {
+		t.Errorf("expected one refresh then cached token, issued %d", issued)
+	}
+
+	bad := NewClientCredentialsSource(ClientCredentialsConfig{TokenURL: idp.URL, ClientID: "client", ClientSecret: "wrong"})
+	if _, err := bad.Token(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
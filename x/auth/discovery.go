@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flyznex/gois"
+)
+
+const (
+	// DefaultDiscoveryRefresh interval provider metadata is kept before being fetched again
+	DefaultDiscoveryRefresh = time.Hour
+	// DefaultHTTPTimeout timeout of the default client fetching metadata and keys
+	DefaultHTTPTimeout = 10 * time.Second
+)
+
+var (
+	ErrIssuerMismatch = errors.New("discovered issuer does not match configured issuer")
+	ErrNoJWKSURI      = errors.New("discovery document has no jwks_uri")
+)
+
+// ProviderMetadata OpenID Connect provider metadata published at /.well-known/openid-configuration
+type ProviderMetadata struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                    string   `json:"token_endpoint,omitempty"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint,omitempty"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint,omitempty"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported,omitempty"`
+}
+
+// Discovery fetch and cache provider metadata of an issuer
+type Discovery struct {
+	// Clock return current time, default time.Now
+	Clock func() time.Time
+
+	issuer  string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	metadata  *ProviderMetadata
+	fetchedAt time.Time
+	err       error
+	// inflight closed when the running fetch completes, nil when none runs
+	inflight chan struct{}
+}
+
+// NewDiscovery create Discovery for issuer, metadata is fetched on first use and
+// refetched once older than refresh (DefaultDiscoveryRefresh when zero). Default
+// client time out after DefaultHTTPTimeout
+func NewDiscovery(issuer string, refresh time.Duration, client *http.Client) *Discovery {
+	if refresh <= 0 {
+		refresh = DefaultDiscoveryRefresh
+	}
+	if client == nil {
+		client = &http.Client{Timeout: DefaultHTTPTimeout}
+	}
+	return &Discovery{issuer: issuer, refresh: refresh, client: client}
+}
+
+// Metadata return cached provider metadata, refreshing it when expired.
+// Stale metadata is served when refresh fails.
+func (d *Discovery) Metadata() (*ProviderMetadata, error) {
+	return d.MetadataContext(context.Background())
+}
+
+// MetadataContext is Metadata bounded by ctx. A single fetch runs at a time:
+// expired metadata is returned at once while it is refreshed in background,
+// without metadata callers wait for the fetch of the first one
+func (d *Discovery) MetadataContext(ctx context.Context) (*ProviderMetadata, error) {
+	d.mu.Lock()
+	m := d.metadata
+	if m != nil && d.now().Sub(d.fetchedAt) < d.refresh {
+		d.mu.Unlock()
+		return m, nil
+	}
+	done := d.inflight
+	if done == nil {
+		d.inflight = make(chan struct{})
+		d.mu.Unlock()
+		if m != nil {
+			go d.update(context.Background())
+			return m, nil
+		}
+		d.update(ctx)
+		return d.result()
+	}
+	d.mu.Unlock()
+	if m != nil {
+		return m, nil
+	}
+	select {
+	case <-done:
+		return d.result()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// update fetch metadata and release callers waiting on inflight
+func (d *Discovery) update(ctx context.Context) {
+	m, err := d.fetch(ctx)
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.err = err
+	if err == nil {
+		d.metadata, d.fetchedAt = m, now
+	}
+	close(d.inflight)
+	d.inflight = nil
+}
+
+func (d *Discovery) now() time.Time {
+	if d.Clock == nil {
+		return time.Now()
+	}
+	return d.Clock()
+}
+
+func (d *Discovery) result() (*ProviderMetadata, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.metadata != nil {
+		return d.metadata, nil
+	}
+	return nil, d.err
+}
+
+func (d *Discovery) fetch(ctx context.Context) (*ProviderMetadata, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(d.issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery: unexpected status %d", resp.StatusCode)
+	}
+	m := &ProviderMetadata{}
+	if err := json.NewDecoder(resp.Body).Decode(m); err != nil {
+		return nil, err
+	}
+	if m.Issuer != d.issuer {
+		return nil, ErrIssuerMismatch
+	}
+	if m.JWKSURI == "" {
+		return nil, ErrNoJWKSURI
+	}
+	return m, nil
+}
+
+// discoveredAlgorithm check token algorithm against id_token_signing_alg_values_supported
+func discoveredAlgorithm(d *Discovery) func(ctx context.Context, alg string) error {
+	return func(ctx context.Context, alg string) error {
+		m, err := d.MetadataContext(ctx)
+		if err != nil {
+			return err
+		}
+		if alg == "" || alg == "none" {
+			return gois.ErrInvalidAlgorithm
+		}
+		if len(m.IDTokenSigningAlgValuesSupported) == 0 {
+			return nil
+		}
+		for _, a := range m.IDTokenSigningAlgValuesSupported {
+			if a == alg {
+				return nil
+			}
+		}
+		return gois.ErrInvalidAlgorithm
+	}
+}
+
+// Discovery return metadata discovery of issuer, nil when issuer is not configured
+// for discovery
+func (am *AuthManager) Discovery(iss string) *Discovery {
+	for _, i := range am.issuers {
+		if i.name == iss {
+			return i.discovery
+		}
+	}
+	return nil
+}
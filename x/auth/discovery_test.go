@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	auth0 "github.com/auth0-community/go-auth0"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// newTestIdP serve discovery document and JWKS, the issuer is the server URL
+func newTestIdP(algs []string, keys ...jose.JSONWebKey) (*httptest.Server, *int32) {
+	var discoveries int32
+	jwks := auth0.JWKS{}
+	for _, k := range keys {
+		jwks.Keys = append(jwks.Keys, k.Public())
+	}
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&discoveries, 1)
+		json.NewEncoder(w).Encode(ProviderMetadata{
+			Issuer:                           ts.URL,
+			JWKSURI:                          ts.URL + "/jwks",
+			UserInfoEndpoint:                 ts.URL + "/userinfo",
+			IDTokenSigningAlgValuesSupported: algs,
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		json.NewEncoder(w).Encode(jwks)
+	})
+	return ts, &discoveries
+}
+
+func TestAuthManagerDiscovery(t *testing.T) {
+	rsKey := genRSASSAJWK(jose.RS256, "rs")
+	esKey := genECDSAJWK(jose.ES384, "es")
+	idp, discoveries := newTestIdP([]string{"RS256"}, rsKey, esKey)
+	defer idp.Close()
+
+	am := NewAuthManager(ConfigAuth{Issuer: idp.URL, Audiences: defaultAudience})
+	h := am.Authenticate()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	claims := defaultTestClaims()
+	claims.Issuer = idp.URL
+	var tests = []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"supported algorithm", signTestToken(rsKey, claims), 200},
+		{"unsupported algorithm", signTestToken(esKey, claims), 401},
+		{"other issuer", signTestToken(rsKey, defaultTestClaims()), 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("unexpected status %d", rr.Code)
+			}
+		})
+	}
+	if got := atomic.LoadInt32(discoveries); got != 1 {
+		t.Errorf("expected discovery document to be cached, fetched %d times", got)
+	}
+	m, err := am.Discovery(idp.URL).Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.UserInfoEndpoint != idp.URL+"/userinfo" {
+		t.Errorf("unexpected userinfo endpoint %q", m.UserInfoEndpoint)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp, _ := newTestIdP(nil)
+	defer idp.Close()
+	if _, err := NewDiscovery(idp.URL+"/", 0, nil).Metadata(); err != ErrIssuerMismatch {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestDiscoveryServeStaleWhileRefreshing(t *testing.T) {
+	var calls int32
+	hang := make(chan struct{})
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	defer close(hang)
+	refreshing := make(chan struct{}, 1)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			refreshing <- struct{}{}
+			select {
+			case <-hang:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(ProviderMetadata{Issuer: ts.URL, JWKSURI: ts.URL + "/jwks"})
+	})
+
+	clock := newTestClock()
+	d := NewDiscovery(ts.URL, 0, nil)
+	d.Clock = clock.Now
+	if _, err := d.Metadata(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(DefaultDiscoveryRefresh)
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 5; i++ {
+			if _, err := d.Metadata(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callers blocked on the refresh")
+	}
+	select {
+	case <-refreshing:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a background refresh")
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expected a single background refresh, got %d fetches", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := NewDiscovery(ts.URL, 0, nil).MetadataContext(ctx); err == nil {
+		t.Error("expected the request context to bound the fetch")
+	}
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// ErrCodeInvalidDPoPProof error code defined by RFC 9449 section 7.1
+const ErrCodeInvalidDPoPProof = "invalid_dpop_proof"
+
+// DefaultDPoPProofLifetime accepted distance between proof iat and now
+const DefaultDPoPProofLifetime = time.Minute
+
+var (
+	// ErrInvalidDPoPProof returned when the DPoP proof of a request is invalid
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+	// ErrDPoPBinding returned when the access token is not bound to the proof key
+	ErrDPoPBinding = errors.New("token is not bound to the DPoP proof key")
+)
+
+// DPoPExtractor read token from "Authorization: DPoP <token>"
+var DPoPExtractor = FromAuthorizationHeader("DPoP")
+
+type (
+	// ReplayCache remember proof identifiers until they expire
+	ReplayCache interface {
+		// Seen record jti until expiry and report whether it was already recorded
+		Seen(jti string, expiry time.Time) bool
+	}
+	// MemoryReplayCache in-memory ReplayCache
+	MemoryReplayCache struct {
+		mu        sync.Mutex
+		seen      map[string]time.Time
+		lastSweep time.Time
+	}
+	// DPoPOptions configure DPoPVerifier
+	DPoPOptions struct {
+		// Required reject bearer tokens, only DPoP-bound tokens are accepted
+		Required bool
+		// ProofLifetime accepted distance between proof iat and now, default DefaultDPoPProofLifetime
+		ProofLifetime time.Duration
+		// Algorithms accepted for proofs, default every asymmetric algorithm
+		Algorithms []jose.SignatureAlgorithm
+		// ReplayCache of proof jti, default MemoryReplayCache
+		ReplayCache ReplayCache
+		// RequestURL return the URL clients see for r, compared with htu. Default
+		// derived from r.TLS, r.Host and r.URL.Path, set it behind reverse proxies
+		RequestURL func(r *http.Request) string
+		// Clock return current time, default time.Now
+		Clock func() time.Time
+	}
+	// DPoPVerifier verify RFC 9449 proofs of DPoP-bound access tokens
+	DPoPVerifier struct {
+		opts           DPoPOptions
+		checkAlgorithm func(alg string) error
+	}
+	dpopProofClaims struct {
+		ID       string           `json:"jti"`
+		Method   string           `json:"htm"`
+		URL      string           `json:"htu"`
+		IssuedAt *jwt.NumericDate `json:"iat"`
+		ATHash   string           `json:"ath"`
+	}
+)
+
+// NewMemoryReplayCache create MemoryReplayCache
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{seen: map[string]time.Time{}}
+}
+
+// Seen implements ReplayCache
+func (c *MemoryReplayCache) Seen(jti string, expiry time.Time) bool {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if exp, ok := c.seen[jti]; ok && now.Before(exp) {
+		return true
+	}
+	c.seen[jti] = expiry
+	if now.Sub(c.lastSweep) >= time.Minute {
+		c.lastSweep = now
+		for k, exp := range c.seen {
+			if !now.Before(exp) {
+				delete(c.seen, k)
+			}
+		}
+	}
+	return false
+}
+
+// NewDPoPVerifier create DPoPVerifier, set it on AuthManager.DPoP
+func NewDPoPVerifier(opts DPoPOptions) *DPoPVerifier {
+	if opts.ProofLifetime <= 0 {
+		opts.ProofLifetime = DefaultDPoPProofLifetime
+	}
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = asymmetricAlgorithms
+	}
+	if opts.ReplayCache == nil {
+		opts.ReplayCache = NewMemoryReplayCache()
+	}
+	if opts.RequestURL == nil {
+		opts.RequestURL = requestURL
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	return &DPoPVerifier{opts: opts, checkAlgorithm: allowAlgorithms(opts.Algorithms...)}
+}
+
+// Verify check the DPoP proof of r against access token raw and its claims.
+// dpop report whether the token was presented with the DPoP scheme
+func (v *DPoPVerifier) Verify(r *http.Request, raw string, claims map[string]interface{}, dpop bool) *AuthError {
+	jkt := confirmation(claims, "jkt")
+	if !dpop {
+		if jkt != "" || v.opts.Required {
+			return errDPoP(ErrCodeInvalidToken, ErrDPoPBinding)
+		}
+		return nil
+	}
+	proofJKT, err := v.verifyProof(r, raw)
+	if err != nil {
+		return errDPoP(ErrCodeInvalidDPoPProof, err)
+	}
+	if jkt == "" || jkt != proofJKT {
+		return errDPoP(ErrCodeInvalidToken, ErrDPoPBinding)
+	}
+	return nil
+}
+
+// verifyProof validate the DPoP header of r and return the thumbprint of its key
+func (v *DPoPVerifier) verifyProof(r *http.Request, raw string) (string, error) {
+	values := r.Header.Values("DPoP")
+	if len(values) != 1 {
+		return "", fmt.Errorf("%w: exactly one DPoP header is required", ErrInvalidDPoPProof)
+	}
+	proof, err := jwt.ParseSigned(values[0])
+	if err != nil || len(proof.Headers) != 1 {
+		return "", fmt.Errorf("%w: malformed proof", ErrInvalidDPoPProof)
+	}
+	header := proof.Headers[0]
+	if typ, _ := header.ExtraHeaders[jose.HeaderType].(string); typ != "dpop+jwt" {
+		return "", fmt.Errorf("%w: typ must be dpop+jwt", ErrInvalidDPoPProof)
+	}
+	if err := v.checkAlgorithm(header.Algorithm); err != nil {
+		return "", fmt.Errorf("%w: unsupported algorithm", ErrInvalidDPoPProof)
+	}
+	jwk := header.JSONWebKey
+	if jwk == nil || !jwk.Valid() || !jwk.IsPublic() {
+		return "", fmt.Errorf("%w: jwk must be a public key", ErrInvalidDPoPProof)
+	}
+	claims := dpopProofClaims{}
+	if err := proof.Claims(jwk.Key, &claims); err != nil {
+		return "", fmt.Errorf("%w: invalid signature", ErrInvalidDPoPProof)
+	}
+	if claims.Method != r.Method {
+		return "", fmt.Errorf("%w: htm mismatch", ErrInvalidDPoPProof)
+	}
+	if !sameURL(claims.URL, v.opts.RequestURL(r)) {
+		return "", fmt.Errorf("%w: htu mismatch", ErrInvalidDPoPProof)
+	}
+	now := v.opts.Clock()
+	if claims.IssuedAt == nil {
+		return "", fmt.Errorf("%w: iat is required", ErrInvalidDPoPProof)
+	}
+	iat := claims.IssuedAt.Time()
+	if iat.Before(now.Add(-v.opts.ProofLifetime)) || iat.After(now.Add(v.opts.ProofLifetime)) {
+		return "", fmt.Errorf("%w: iat out of range", ErrInvalidDPoPProof)
+	}
+	sum := sha256.Sum256([]byte(raw))
+	if claims.ATHash != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		return "", fmt.Errorf("%w: ath mismatch", ErrInvalidDPoPProof)
+	}
+	if claims.ID == "" {
+		return "", fmt.Errorf("%w: jti is required", ErrInvalidDPoPProof)
+	}
+	if v.opts.ReplayCache.Seen(claims.ID, iat.Add(2*v.opts.ProofLifetime)) {
+		return "", fmt.Errorf("%w: proof replayed", ErrInvalidDPoPProof)
+	}
+	thumb, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+	return base64.RawURLEncoding.EncodeToString(thumb), nil
+}
+
+func errDPoP(code string, err error) *AuthError {
+	description := err.Error()
+	if code == ErrCodeInvalidDPoPProof {
+		description = strings.TrimPrefix(description, ErrInvalidDPoPProof.Error()+": ")
+	}
+	return &AuthError{Status: http.StatusUnauthorized, Scheme: "DPoP", Code: code, Description: description, Err: err}
+}
+
+// confirmation return member of the cnf claim
+func confirmation(claims map[string]interface{}, member string) string {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	v, _ := cnf[member].(string)
+	return v
+}
+
+// requestURL rebuild the URL of r without query and fragment
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// sameURL compare htu with the request URL ignoring query, fragment and case of scheme and host
+func sameURL(htu, target string) bool {
+	a, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host) && a.EscapedPath() == b.EscapedPath()
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func signDPoPProof(key jose.JSONWebKey, typ string, claims map[string]interface{}) string {
+	opts := (&jose.SignerOptions{EmbedJWK: true}).WithType(jose.ContentType(typ))
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key.Key}, opts)
+	if err != nil {
+		panic(err)
+	}
+	raw, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
+
+func jwkThumbprint(key jose.JSONWebKey) string {
+	pub := key.Public()
+	thumb, err := pub.Thumbprint(crypto.SHA256)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(thumb)
+}
+
+func TestDPoP(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{Issuer: defaultIssuer, Audiences: defaultAudience, IdentityServerURI: ts.URL})
+	am.DPoP = NewDPoPVerifier(DPoPOptions{})
+
+	client := genECDSAJWK(jose.ES256, "")
+	other := genECDSAJWK(jose.ES256, "")
+	bound := signTestToken(key, defaultTestClaims(), map[string]interface{}{"cnf": map[string]interface{}{"jkt": jwkThumbprint(client)}})
+	bearer := signTestToken(key, defaultTestClaims())
+	ath := func(token string) string {
+		sum := sha256.Sum256([]byte(token))
+		return base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	proofClaims := func(jti string, mod func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"jti": jti,
+			"htm": "POST",
+			"htu": "https://api.example.com/orders",
+			"iat": time.Now().Unix(),
+			"ath": ath(bound),
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+
+	var tests = []struct {
+		name     string
+		scheme   string
+		token    string
+		proof    string
+		want     int
+		wantCode string
+	}{
+		{"valid proof", "DPoP", bound, signDPoPProof(client, "dpop+jwt", proofClaims("1", nil)), 200, ""},
+		{"replayed proof", "DPoP", bound, signDPoPProof(client, "dpop+jwt", proofClaims("1", nil)), 401, ErrCodeInvalidDPoPProof},
+		{"missing proof", "DPoP", bound, "", 401, ErrCodeInvalidDPoPProof},
+		{"wrong typ", "DPoP", bound, signDPoPProof(client, "JWT", proofClaims("2", nil)), 401, ErrCodeInvalidDPoPProof},
+		{"wrong method", "DPoP", bound, signDPoPProof(client, "dpop+jwt", proofClaims("3", func(c map[string]interface{}) { c["htm"] = "GET" })), 401, ErrCodeInvalidDPoPProof},
+		{"wrong url", "DPoP", bound, signDPoPProof(client, "dpop+jwt", proofClaims("4", func(c map[string]interface{}) { c["htu"] = "https://api.example.com/users" })), 401, ErrCodeInvalidDPoPProof},
+		{"stale proof", "DPoP", bound, signDPoPProof(client, "dpop+jwt", proofClaims("5", func(c map[string]interface{}) { c["iat"] = time.Now().Add(-time.Hour).Unix() })), 401, ErrCodeInvalidDPoPProof},
+		{"wrong ath", "DPoP", bound, signDPoPProof(client, "dpop+jwt", proofClaims("6", func(c map[string]interface{}) { c["ath"] = ath(bearer) })), 401, ErrCodeInvalidDPoPProof},
+		{"other key", "DPoP", bound, signDPoPProof(other, "dpop+jwt", proofClaims("7", nil)), 401, ErrCodeInvalidToken},
+		{"bound token as bearer", "Bearer", bound, "", 401, ErrCodeInvalidToken},
+		{"plain bearer token", "Bearer", bearer, "", 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "https://api.example.com/orders?page=2", nil)
+			req.Header.Set("Authorization", tt.scheme+" "+tt.token)
+			if tt.proof != "" {
+				req.Header.Set("DPoP", tt.proof)
+			}
+			rr := httptest.NewRecorder()
+			am.Authenticate()(okHandler).ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Fatalf("unexpected status %d, want %d", rr.Code, tt.want)
+			}
+			challenge := rr.Header().Get("WWW-Authenticate")
+			if tt.wantCode != "" && (!strings.HasPrefix(challenge, "DPoP ") || !strings.Contains(challenge, `error="`+tt.wantCode+`"`)) {
+				t.Errorf("unexpected challenge %q", challenge)
+			}
+		})
+	}
+
+	am.DPoP = NewDPoPVerifier(DPoPOptions{Required: true})
+	if got := serveWithToken(am.Authenticate()(okHandler), bearer); got != 401 {
+		t.Errorf("expected bearer token to be rejected when DPoP is required, got %d", got)
+	}
+}
+
+func TestDPoPBoundTokenWithoutProof(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{Issuer: defaultIssuer, Audiences: defaultAudience, IdentityServerURI: ts.URL})
+	am.DPoP = NewDPoPVerifier(DPoPOptions{})
+	client, stop := dialTestHealth(t, am, nil, nil)
+	defer stop()
+
+	bound := signTestToken(key, defaultTestClaims(), map[string]interface{}{"cnf": map[string]interface{}{"jkt": jwkThumbprint(genECDSAJWK(jose.ES256, ""))}})
+	bearer := signTestToken(key, defaultTestClaims())
+	call := func(token string) codes.Code {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		return status.Code(err)
+	}
+	deliver := func(token string) bool {
+		handled := false
+		h := am.AMQPHandler(AMQPOptions{OnError: func(amqp.Delivery, *AuthError) {}}, func(context.Context, amqp.Delivery) { handled = true })
+		h(amqp.Delivery{Headers: amqp.Table{"Authorization": "Bearer " + token}})
+		return handled
+	}
+
+	if got := call(bound); got != codes.Unauthenticated {
+		t.Errorf("gRPC: unexpected code %v for DPoP-bound token", got)
+	}
+	if got := call(bearer); got != codes.OK {
+		t.Errorf("gRPC: unexpected code %v for bearer token", got)
+	}
+	if deliver(bound) {
+		t.Error("AMQP: DPoP-bound token accepted without proof")
+	}
+	if !deliver(bearer) {
+		t.Error("AMQP: bearer token rejected")
+	}
+
+	am.DPoP = NewDPoPVerifier(DPoPOptions{Required: true})
+	if got := call(bearer); got != codes.Unauthenticated {
+		t.Errorf("gRPC: unexpected code %v for bearer token when DPoP is required", got)
+	}
+	if deliver(bearer) {
+		t.Error("AMQP: bearer token accepted when DPoP is required")
+	}
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/flyznex/gois"
+	"github.com/flyznex/goutils/x/httpext"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Error codes defined by RFC 6750 section 3.1
+const (
+	ErrCodeInvalidRequest    = "invalid_request"
+	ErrCodeInvalidToken      = "invalid_token"
+	ErrCodeInsufficientScope = "insufficient_scope"
+)
+
+// AuthError authentication or authorization failure, rendered as
+// WWW-Authenticate challenge by ErrorResponder
+type AuthError struct {
+	// HTTP status, 401 or 403
+	Status int
+	// Authentication scheme of the challenge, default Bearer
+	Scheme string
+	// RFC 6750 error code, empty when request carried no credentials
+	Code string
+	// Human-readable description
+	Description string
+	// Scope required by the resource
+	Scope string
+	// Realm of the protected resource
+	Realm string
+	// Nested error
+	Err error
+	// Alternatives failures of other schemes, challenged as well
+	Alternatives []*AuthError
+}
+
+func (e *AuthError) Error() string {
+	if e.Code == "" {
+		return http.StatusText(e.Status)
+	}
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// Unwrap return the nested error
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode used by httpext.EncodeError
+func (e *AuthError) StatusCode() int {
+	return e.Status
+}
+
+// Challenge build WWW-Authenticate value. Error parameters are defined for
+// token schemes only (Bearer, DPoP), other schemes are challenged with realm
+func (e *AuthError) Challenge() string {
+	scheme := e.Scheme
+	if scheme == "" {
+		scheme = "Bearer"
+	}
+	var params []string
+	if e.Realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", e.Realm))
+	}
+	if scheme == "Bearer" || scheme == "DPoP" {
+		if e.Code != "" {
+			params = append(params, fmt.Sprintf("error=%q", e.Code))
+		}
+		if e.Description != "" {
+			params = append(params, fmt.Sprintf("error_description=%q", e.Description))
+		}
+		if e.Scope != "" {
+			params = append(params, fmt.Sprintf("scope=%q", e.Scope))
+		}
+	}
+	if len(params) == 0 {
+		return scheme
+	}
+	return scheme + " " + strings.Join(params, ", ")
+}
+
+// ErrorResponder write auth failure to client
+type ErrorResponder func(w http.ResponseWriter, r *http.Request, err *AuthError)
+
+// WriteError default responder, set WWW-Authenticate and write plain text body
+func WriteError(w http.ResponseWriter, r *http.Request, err *AuthError) {
+	setChallenges(w, err)
+	http.Error(w, http.StatusText(err.Status), err.Status)
+}
+
+// WriteJSONError set WWW-Authenticate and write JSON body with httpext.EncodeError
+func WriteJSONError(w http.ResponseWriter, r *http.Request, err *AuthError) {
+	setChallenges(w, err)
+	httpext.EncodeError(r.Context(), err, w)
+}
+
+// setChallenges set one WWW-Authenticate header by scheme of err
+func setChallenges(w http.ResponseWriter, err *AuthError) {
+	w.Header().Set("WWW-Authenticate", err.Challenge())
+	for _, alt := range err.Alternatives {
+		w.Header().Add("WWW-Authenticate", alt.Challenge())
+	}
+}
+
+// asAuthError return err when it is already an AuthError, an invalid token error otherwise
+func asAuthError(err error) *AuthError {
+	if ae, ok := err.(*AuthError); ok {
+		return ae
+	}
+	return errInvalidToken(err)
+}
+
+func errMissingToken() *AuthError {
+	return &AuthError{Status: http.StatusUnauthorized}
+}
+
+func errInvalidToken(err error) *AuthError {
+	return &AuthError{Status: http.StatusUnauthorized, Code: ErrCodeInvalidToken, Description: describe(err), Err: err}
+}
+
+func errInvalidRequest(description string) *AuthError {
+	return &AuthError{Status: http.StatusBadRequest, Code: ErrCodeInvalidRequest, Description: description}
+}
+
+func errInsufficientScope(description string, scopes ...string) *AuthError {
+	return &AuthError{
+		Status:      http.StatusForbidden,
+		Code:        ErrCodeInsufficientScope,
+		Description: description,
+		Scope:       strings.Join(scopes, " "),
+	}
+}
+
+// describe map validation error to error_description without leaking internals
+func describe(err error) string {
+	if ae, ok := err.(*AuthError); ok {
+		return ae.Description
+	}
+	if errors.Is(err, ErrMissingClaim) {
+		return err.Error()
+	}
+	switch err {
+	case jwt.ErrExpired:
+		return "token is expired"
+	case jwt.ErrNotValidYet:
+		return "token is not valid yet"
+	case jwt.ErrIssuedInTheFuture:
+		return "token is issued in the future"
+	case ErrTokenTooOld:
+		return "token is too old"
+	case jwt.ErrInvalidIssuer:
+		return "invalid issuer"
+	case jwt.ErrInvalidAudience:
+		return "invalid audience"
+	case gois.ErrInvalidAlgorithm:
+		return "invalid signing algorithm"
+	case ErrUnknownIssuer:
+		return "unknown issuer"
+	case ErrTokenInactive:
+		return "token is not active"
+	case ErrTokenRevoked:
+		return "token is revoked"
+	case ErrCertificateBinding:
+		return "token is not bound to the client certificate"
+	case ErrInvalidAPIKey:
+		return "invalid API key"
+	case ErrAPIKeyExpired:
+		return "API key is expired"
+	case ErrInvalidCredentials:
+		return "invalid credentials"
+	}
+	return "token is invalid"
+}
+
+var responderKey = &contextKey{"Responder"}
+
+// withResponder store responder so authorization middlewares answer the same way
+func withResponder(ctx context.Context, fn ErrorResponder) context.Context {
+	return context.WithValue(ctx, responderKey, fn)
+}
+
+func respond(w http.ResponseWriter, r *http.Request, err *AuthError) {
+	fn, ok := r.Context().Value(responderKey).(ErrorResponder)
+	if !ok {
+		fn = WriteError
+	}
+	fn(w, r, err)
+}
+
+// realmResponder fill realm of errors before handing them to fn
+func realmResponder(realm string, fn ErrorResponder) ErrorResponder {
+	if fn == nil {
+		fn = WriteError
+	}
+	return func(w http.ResponseWriter, r *http.Request, err *AuthError) {
+		if err.Realm == "" {
+			err.Realm = realm
+		}
+		fn(w, r, err)
+	}
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestAuthenticateChallenges(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{
+		Issuer:            defaultIssuer,
+		Audiences:         defaultAudience,
+		IdentityServerURI: ts.URL,
+		Realm:             "api",
+	})
+	h := am.Authenticate()(RequireRoles("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	expired := defaultTestClaims()
+	expired.Expiry = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	var tests = []struct {
+		name      string
+		token     string
+		status    int
+		challenge string
+	}{
+		{"missing", "", 401, `Bearer realm="api"`},
+		{"expired", signTestToken(key, expired), 401, `Bearer realm="api", error="invalid_token", error_description="token is expired"`},
+		{"malformed", "not-a-jwt", 401, `Bearer realm="api", error="invalid_token", error_description="token is invalid"`},
+		{"no role", signTestToken(key, defaultTestClaims()), 403, `Bearer realm="api", error="insufficient_scope", error_description="missing required role"`},
+		{"role", signTestToken(key, defaultTestClaims(), map[string]interface{}{"role": "admin"}), 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("unexpected status %d", rr.Code)
+			}
+			if got := rr.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("unexpected challenge %q", got)
+			}
+		})
+	}
+}
+
+func TestWriteJSONError(t *testing.T) {
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	WriteJSONError(rr, req, errInsufficientScope("", "read", "write"))
+	if rr.Code != 403 {
+		t.Errorf("unexpected status %d", rr.Code)
+	}
+	if got := rr.Header().Get("WWW-Authenticate"); !strings.Contains(got, `scope="read write"`) {
+		t.Errorf("unexpected challenge %q", got)
+	}
+	body := map[string]string{}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body["err"] != ErrCodeInsufficientScope {
+		t.Errorf("unexpected body %v", body)
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrTokenNotFound returned by extractors when request does not carry a token
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenExtractor extract raw token from request
+type TokenExtractor interface {
+	Extract(r *http.Request) (string, error)
+}
+
+// TokenExtractorFunc function conforming to TokenExtractor
+type TokenExtractorFunc func(r *http.Request) (string, error)
+
+// Extract calls f(r)
+func (f TokenExtractorFunc) Extract(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// BearerExtractor default extractor, read token from "Authorization: Bearer <token>"
+var BearerExtractor = FromAuthorizationHeader("Bearer")
+
+// FromAuthorizationHeader read token from Authorization header with given scheme
+func FromAuthorizationHeader(scheme string) TokenExtractor {
+	prefix := scheme + " "
+	return TokenExtractorFunc(func(r *http.Request) (string, error) {
+		h := r.Header.Get("Authorization")
+		if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+			return "", ErrTokenNotFound
+		}
+		return strings.TrimSpace(h[len(prefix):]), nil
+	})
+}
+
+// FromHeader read token from the whole value of the given header
+func FromHeader(name string) TokenExtractor {
+	return TokenExtractorFunc(func(r *http.Request) (string, error) {
+		if v := r.Header.Get(name); v != "" {
+			return v, nil
+		}
+		return "", ErrTokenNotFound
+	})
+}
+
+// FromCookie read token from cookie with given name
+func FromCookie(name string) TokenExtractor {
+	return TokenExtractorFunc(func(r *http.Request) (string, error) {
+		c, err := r.Cookie(name)
+		if err != nil || c.Value == "" {
+			return "", ErrTokenNotFound
+		}
+		return c.Value, nil
+	})
+}
+
+// FromQuery read token from url query parameter with given name
+func FromQuery(name string) TokenExtractor {
+	return TokenExtractorFunc(func(r *http.Request) (string, error) {
+		if v := r.URL.Query().Get(name); v != "" {
+			return v, nil
+		}
+		return "", ErrTokenNotFound
+	})
+}
+
+// FromWebSocketProtocol read token from Sec-WebSocket-Protocol header, browsers
+// send it as the protocol following marker, e.g. "access_token, <token>"
+func FromWebSocketProtocol(marker string) TokenExtractor {
+	return TokenExtractorFunc(func(r *http.Request) (string, error) {
+		var protocols []string
+		for _, h := range r.Header.Values("Sec-WebSocket-Protocol") {
+			for _, p := range strings.Split(h, ",") {
+				protocols = append(protocols, strings.TrimSpace(p))
+			}
+		}
+		for i := 0; i < len(protocols)-1; i++ {
+			if protocols[i] == marker && protocols[i+1] != "" {
+				return protocols[i+1], nil
+			}
+		}
+		return "", ErrTokenNotFound
+	})
+}
+
+// FromFirst chain extractors, the first one finding a token wins
+func FromFirst(extractors ...TokenExtractor) TokenExtractor {
+	return TokenExtractorFunc(func(r *http.Request) (string, error) {
+		for _, e := range extractors {
+			raw, err := e.Extract(r)
+			if err == ErrTokenNotFound {
+				continue
+			}
+			return raw, err
+		}
+		return "", ErrTokenNotFound
+	})
+}
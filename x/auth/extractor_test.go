@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtractors(t *testing.T) {
+	var tests = []struct {
+		name      string
+		extractor TokenExtractor
+		prepare   func(r *http.Request)
+		want      string
+		wantErr   error
+	}{
+		{"bearer", BearerExtractor, func(r *http.Request) { r.Header.Set("Authorization", "bearer abc") }, "abc", nil},
+		{"bearer missing", BearerExtractor, func(r *http.Request) { r.Header.Set("Authorization", "Basic abc") }, "", ErrTokenNotFound},
+		{"header", FromHeader("X-Token"), func(r *http.Request) { r.Header.Set("X-Token", "abc") }, "abc", nil},
+		{"cookie", FromCookie("access_token"), func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "access_token", Value: "abc"}) }, "abc", nil},
+		{"query", FromQuery("token"), func(r *http.Request) { r.URL.RawQuery = "token=abc" }, "abc", nil},
+		{"websocket", FromWebSocketProtocol("access_token"), func(r *http.Request) { r.Header.Set("Sec-WebSocket-Protocol", "chat, access_token, abc") }, "abc", nil},
+		{"first", FromFirst(BearerExtractor, FromQuery("token")), func(r *http.Request) { r.URL.RawQuery = "token=abc" }, "abc", nil},
+		{"first missing", FromFirst(BearerExtractor, FromQuery("token")), func(r *http.Request) {}, "", ErrTokenNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			tt.prepare(req)
+			got, err := tt.extractor.Extract(req)
+			if err != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateWithCookieExtractor(t *testing.T) {
+	opts, token, _, err := genNewTestServer(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	am := NewAuthManager(ConfigAuth{
+		Issuer:            defaultIssuer,
+		Audiences:         defaultAudience,
+		IdentityServerURI: opts.URI,
+	})
+	am.Extractor = FromCookie("access_token")
+	h := am.Authenticate()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Context().Value(JWTToken); got != token {
+			t.Errorf("unexpected JWTToken %v", got)
+		}
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: token})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != 200 {
+		t.Errorf("unexpected status %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != 401 {
+		t.Errorf("unexpected status %d", rr.Code)
+	}
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	// MethodRequirement roles (any of) and scopes (all of) required to call a gRPC method
+	MethodRequirement struct {
+		Roles  []string
+		Scopes []string
+	}
+	// GRPCOptions configure gRPC interceptors of AuthManager
+	GRPCOptions struct {
+		// Methods requirement by full method name (/package.Service/Method),
+		// methods not listed only require authentication
+		Methods map[string]MethodRequirement
+		// Public full method names served without authentication
+		Public []string
+	}
+	// authServerStream ServerStream carrying the authenticated context
+	authServerStream struct {
+		grpc.ServerStream
+		ctx context.Context
+	}
+)
+
+// UnaryServerInterceptor authenticate the bearer token of the "authorization"
+// metadata, handlers read the same context values as with Authenticate
+func (am *AuthManager) UnaryServerInterceptor(opts GRPCOptions) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := am.authorizeRPC(ctx, info.FullMethod, opts)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor stream counterpart of UnaryServerInterceptor
+func (am *AuthManager) StreamServerInterceptor(opts GRPCOptions) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := am.authorizeRPC(ss.Context(), info.FullMethod, opts)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// authorizeRPC authenticate call to method and check its requirement
+func (am *AuthManager) authorizeRPC(ctx context.Context, method string, opts GRPCOptions) (context.Context, error) {
+	if contains(opts.Public, method) {
+		return ctx, nil
+	}
+	raw := bearerFromMetadata(ctx)
+	if raw == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	token, claims, iss, err := am.verify(ctx, raw, presentation{cert: peerCertificateFromContext(ctx)})
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, describe(err))
+	}
+	ctx = context.WithValue(ctx, JWTToken, raw)
+	ctx = context.WithValue(ctx, TokenKey, token)
+	ctx = contextWithClaims(ctx, claims, iss.mapping)
+
+	req, ok := opts.Methods[method]
+	if !ok {
+		return ctx, nil
+	}
+	if len(req.Roles) > 0 {
+		roles := GetRolesFromContext(ctx)
+		granted := false
+		for _, r := range req.Roles {
+			if _, ok := roles[r]; ok {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			return nil, status.Error(codes.PermissionDenied, "missing required role")
+		}
+	}
+	scopes := GetScopesFromContext(ctx)
+	for _, s := range req.Scopes {
+		if _, ok := scopes[s]; !ok {
+			return nil, status.Error(codes.PermissionDenied, "missing required scope")
+		}
+	}
+	return ctx, nil
+}
+
+// peerCertificateFromContext return the client certificate of a gRPC TLS connection
+func peerCertificateFromContext(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return peerCertificate(&info.State)
+}
+
+func bearerFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, v := range md.Get("authorization") {
+		if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+			return strings.TrimSpace(v[7:])
+		}
+	}
+	return ""
+}
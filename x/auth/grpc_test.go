@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// userHealthServer record the user id of the authenticated context
+type userHealthServer struct {
+	*health.Server
+	userID chan string
+}
+
+func (s *userHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s.userID <- GetUserIDFromContext(ctx)
+	return s.Server.Check(ctx, req)
+}
+
+func (s *userHealthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	s.userID <- GetUserIDFromContext(stream.Context())
+	return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{Issuer: defaultIssuer, Audiences: defaultAudience, IdentityServerURI: ts.URL})
+	opts := GRPCOptions{Methods: map[string]MethodRequirement{
+		"/grpc.health.v1.Health/Watch": {Roles: []string{"monitor"}},
+	}}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(am.UnaryServerInterceptor(opts)),
+		grpc.StreamInterceptor(am.StreamServerInterceptor(opts)),
+	)
+	hs := &userHealthServer{Server: health.NewServer(), userID: make(chan string, 1)}
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	user := signTestToken(key, defaultTestClaims())
+	monitor := signTestToken(key, defaultTestClaims(), map[string]interface{}{"role": "monitor"})
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+	watch := func(ctx context.Context) error {
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	}
+
+	var tests = []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"unary without token", func() error {
+			_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+			return err
+		}, codes.Unauthenticated},
+		{"unary with invalid token", func() error {
+			_, err := client.Check(withToken("bad"), &healthpb.HealthCheckRequest{})
+			return err
+		}, codes.Unauthenticated},
+		{"unary authenticated", func() error {
+			_, err := client.Check(withToken(user), &healthpb.HealthCheckRequest{})
+			return err
+		}, codes.OK},
+		{"stream missing role", func() error { return watch(withToken(user)) }, codes.PermissionDenied},
+		{"stream with role", func() error { return watch(withToken(monitor)) }, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("unexpected code %v, want %v (%v)", got, tt.want, err)
+			}
+			if tt.want == codes.OK {
+				if id := <-hs.userID; id != "user-id" {
+					t.Errorf("unexpected user id %q", id)
+				}
+			}
+		})
+	}
+}
+
+// dialTestHealth serve the health service behind the unary interceptor of am,
+// over TLS when server and client configs are set
+func dialTestHealth(t *testing.T, am *AuthManager, server, client *tls.Config) (healthpb.HealthClient, func()) {
+	lis := bufconn.Listen(1 << 20)
+	serverOpts := []grpc.ServerOption{grpc.UnaryInterceptor(am.UnaryServerInterceptor(GRPCOptions{}))}
+	dialOpts := []grpc.DialOption{grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() })}
+	if server != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(server)))
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(client)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	}
+	srv := grpc.NewServer(serverOpts...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	conn, err := grpc.Dial("bufnet", dialOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return healthpb.NewHealthClient(conn), func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
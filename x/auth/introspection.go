@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTokenInactive returned when introspection endpoint report token as not active
+var ErrTokenInactive = errors.New("token is not active")
+
+type (
+	// IntrospectionConfig configure RFC 7662 token introspection
+	IntrospectionConfig struct {
+		// Endpoint of the introspection service
+		Endpoint string
+		// Client credentials used to authenticate to the endpoint
+		ClientID     string
+		ClientSecret string
+		// RoleClaims claim paths of the response merged into roles, default "role"
+		RoleClaims []string
+		// RoleHierarchy expand roles read from the response with the roles they imply
+		RoleHierarchy *RoleHierarchy
+		// TenantClaim claim path of the tenant exposed by Principal, default "tenant"
+		TenantClaim string
+		// CacheTTL upper bound active results are cached, results are never
+		// cached past their exp. Zero cache until exp
+		CacheTTL time.Duration
+		// Realm reported in WWW-Authenticate challenges
+		Realm string
+		// Client calling the endpoint, default time out after DefaultHTTPTimeout
+		Client *http.Client
+	}
+	// Introspector authenticate opaque tokens with an introspection endpoint
+	Introspector struct {
+		// Extractor read raw token from request, default BearerExtractor
+		Extractor TokenExtractor
+		// ErrorResponder write auth failures, default WriteError
+		ErrorResponder ErrorResponder
+		cfg            IntrospectionConfig
+
+		mu    sync.Mutex
+		cache map[[sha256.Size]byte]introspectionEntry
+	}
+	introspectionEntry struct {
+		claims  map[string]interface{}
+		expires time.Time
+	}
+)
+
+// NewIntrospector create Introspector
+func NewIntrospector(cfg IntrospectionConfig) *Introspector {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultHTTPTimeout}
+	}
+	return &Introspector{
+		Extractor: BearerExtractor,
+		cfg:       cfg,
+		cache:     map[[sha256.Size]byte]introspectionEntry{},
+	}
+}
+
+// Authenticate middleware introspect bearer token and populate the same context
+// values as AuthManager.Authenticate
+func (in *Introspector) Authenticate() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		hfn := func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := in.authenticate(r)
+			if err != nil {
+				in.responder()(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(hfn)
+	}
+}
+
+func (in *Introspector) authenticate(r *http.Request) (context.Context, *AuthError) {
+	extractor := in.Extractor
+	if extractor == nil {
+		extractor = BearerExtractor
+	}
+	raw, err := extractor.Extract(r)
+	if err == ErrTokenNotFound || (err == nil && raw == "") {
+		return nil, errMissingToken()
+	}
+	if err != nil {
+		return nil, errInvalidToken(err)
+	}
+	claims, err := in.Introspect(r.Context(), raw)
+	if err != nil {
+		return nil, errInvalidToken(err)
+	}
+	ctx := withResponder(r.Context(), in.responder())
+	ctx = context.WithValue(ctx, JWTToken, raw)
+	return contextWithClaims(ctx, claims, claimMapping{roleClaims: in.cfg.RoleClaims, tenantClaim: in.cfg.TenantClaim, hierarchy: in.cfg.RoleHierarchy}), nil
+}
+
+func (in *Introspector) responder() ErrorResponder {
+	return realmResponder(in.cfg.Realm, in.ErrorResponder)
+}
+
+// Introspect return the introspection response of an active token, cached until exp
+func (in *Introspector) Introspect(ctx context.Context, token string) (map[string]interface{}, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+	in.mu.Lock()
+	entry, ok := in.cache[key]
+	in.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.claims, nil
+	}
+
+	claims, err := in.introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if expires, ok := in.expiry(claims, now); ok {
+		in.mu.Lock()
+		for k, e := range in.cache {
+			if !now.Before(e.expires) {
+				delete(in.cache, k)
+			}
+		}
+		in.cache[key] = introspectionEntry{claims: claims, expires: expires}
+		in.mu.Unlock()
+	}
+	return claims, nil
+}
+
+func (in *Introspector) introspect(ctx context.Context, token string) (map[string]interface{}, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest(http.MethodPost, in.cfg.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if in.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(in.cfg.ClientID), url.QueryEscape(in.cfg.ClientSecret))
+	}
+	resp, err := in.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection: unexpected status %d", resp.StatusCode)
+	}
+	claims := map[string]interface{}{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, err
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, ErrTokenInactive
+	}
+	if exp, ok := claims["exp"].(float64); ok && !time.Now().Before(time.Unix(int64(exp), 0)) {
+		return nil, ErrTokenInactive
+	}
+	return claims, nil
+}
+
+// expiry compute cache expiry of an active result, false when it must not be cached
+func (in *Introspector) expiry(claims map[string]interface{}, now time.Time) (time.Time, bool) {
+	var expires time.Time
+	if exp, ok := claims["exp"].(float64); ok {
+		expires = time.Unix(int64(exp), 0)
+	}
+	if in.cfg.CacheTTL > 0 && (expires.IsZero() || now.Add(in.cfg.CacheTTL).Before(expires)) {
+		expires = now.Add(in.cfg.CacheTTL)
+	}
+	return expires, !expires.IsZero()
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIntrospector(t *testing.T) {
+	calls := 0
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if id, secret, ok := r.BasicAuth(); !ok || id != "api" || secret != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		resp := map[string]interface{}{"active": false}
+		if r.PostFormValue("token") == "opaque-active" {
+			resp = map[string]interface{}{
+				"active": true,
+				"sub":    "user-id",
+				"scope":  "read write",
+				"role":   []string{"admin"},
+				"exp":    time.Now().Add(time.Hour).Unix(),
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer idp.Close()
+
+	in := NewIntrospector(IntrospectionConfig{Endpoint: idp.URL, ClientID: "api", ClientSecret: "secret"})
+	h := in.Authenticate()(RequireRoles("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUserIDFromContext(r.Context())))
+	})))
+	var tests = []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"active", "opaque-active", 200},
+		{"cached", "opaque-active", 200},
+		{"inactive", "opaque-revoked", 401},
+		{"missing", "", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("unexpected status %d", rr.Code)
+			}
+			if tt.status == 200 && rr.Body.String() != "user-id" {
+				t.Errorf("unexpected body %q", rr.Body.String())
+			}
+		})
+	}
+	if calls != 2 {
+		t.Errorf("expected active result to be cached, endpoint called %d times", calls)
+	}
+}
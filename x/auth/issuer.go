@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/flyznex/gois"
+	"github.com/sirupsen/logrus"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// ErrUnknownIssuer returned when token issuer is not configured on AuthManager
+var ErrUnknownIssuer = errors.New("unknown issuer")
+
+// issuer validate tokens of a single identity provider
+type issuer struct {
+	name      string
+	validator *gois.JWTValidator
+	mapping   claimMapping
+	temporal  temporalRules
+	discovery *Discovery
+	jwks      *JWKSProvider
+	// checkAlgorithm verify token algorithm when validator trusts the key provider
+	checkAlgorithm func(ctx context.Context, alg string) error
+}
+
+// newIssuer create issuer from config. Keys are static when PublicKeysPEM, JWKSFile
+// or HMACSecret is set, fetched from IdentityServerURI otherwise, and discovered
+// from the issuer when IdentityServerURI is not set either.
+func newIssuer(cfg ConfigAuth, extractor gois.RequestTokenExtractor) (*issuer, error) {
+	iss := &issuer{
+		name:     cfg.Issuer,
+		mapping:  claimMapping{roleClaims: cfg.RoleClaims, tenantClaim: cfg.TenantClaim, hierarchy: cfg.RoleHierarchy},
+		temporal: newTemporalRules(cfg),
+	}
+	static, err := staticKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		keys gois.SecretProvider
+		algs []jose.SignatureAlgorithm
+	)
+	if static != nil {
+		keys, algs = static, asymmetricAlgorithms
+		if cfg.HMACSecret != "" {
+			algs = hmacAlgorithms
+		}
+	} else {
+		if cfg.IdentityServerURI == "" && cfg.Issuer != "" {
+			iss.discovery = NewDiscovery(cfg.Issuer, cfg.DiscoveryRefresh, nil)
+		}
+		iss.jwks = NewJWKSProvider(JWKSOptions{
+			URI:                cfg.IdentityServerURI,
+			Discovery:          iss.discovery,
+			CacheTTL:           cfg.JWKSCacheTTL,
+			RefreshInterval:    cfg.JWKSRefreshInterval,
+			MinRefetchInterval: cfg.JWKSMinRefetchInterval,
+			OnFetch:            cfg.OnJWKSFetch,
+		})
+		keys = iss.jwks
+	}
+	var configuration gois.Configuration
+	switch {
+	case cfg.MethodSignature != "":
+		configuration = gois.NewConfiguration(keys, cfg.Audiences, cfg.Issuer, jose.SignatureAlgorithm(cfg.MethodSignature))
+	case algs != nil:
+		configuration = gois.NewConfigurationTrustProvider(keys, cfg.Audiences, cfg.Issuer)
+		allow := allowAlgorithms(algs...)
+		iss.checkAlgorithm = func(_ context.Context, alg string) error { return allow(alg) }
+	case iss.discovery != nil:
+		configuration = gois.NewConfigurationTrustProvider(keys, cfg.Audiences, cfg.Issuer)
+		iss.checkAlgorithm = discoveredAlgorithm(iss.discovery)
+	default:
+		configuration = gois.NewConfiguration(keys, cfg.Audiences, cfg.Issuer, jose.RS256)
+	}
+	iss.validator = gois.NewValidator(configuration, extractor)
+	return iss, nil
+}
+
+// issuer create issuer of Authenticator, keys are fetched from Options unless
+// static keys are set
+func (auth *AuthModel) issuer() *issuer {
+	cfg := ConfigAuth{
+		Issuer:         auth.Issuer,
+		Audiences:      auth.Audience,
+		PublicKeysPEM:  auth.PublicKeysPEM,
+		JWKSFile:       auth.JWKSFile,
+		HMACSecret:     auth.HMACSecret,
+		Leeway:         auth.Leeway,
+		MaxAge:         auth.MaxAge,
+		RequiredClaims: auth.RequiredClaims,
+		Clock:          auth.Clock,
+	}
+	static, err := staticKeys(cfg)
+	if err != nil {
+		logrus.Errorf("auth: invalid keys for issuer %q, all tokens will be rejected: %v", auth.Issuer, err)
+		return brokenIssuer(cfg, nil, err)
+	}
+	iss := &issuer{
+		name:     auth.Issuer,
+		mapping:  claimMapping{roleClaims: auth.RoleClaims, tenantClaim: auth.TenantClaim, hierarchy: auth.RoleHierarchy},
+		temporal: newTemporalRules(cfg),
+	}
+	var keys gois.SecretProvider = gois.NewJWKClient(auth.Options, nil)
+	algs := asymmetricAlgorithms
+	if static != nil {
+		keys = static
+		if auth.HMACSecret != "" {
+			algs = hmacAlgorithms
+		}
+	}
+	configuration := gois.NewConfiguration(keys, auth.Audience, auth.Issuer, auth.MethodSignature)
+	if auth.MethodSignature == "" {
+		configuration = gois.NewConfigurationTrustProvider(keys, auth.Audience, auth.Issuer)
+		allow := allowAlgorithms(algs...)
+		iss.checkAlgorithm = func(_ context.Context, alg string) error { return allow(alg) }
+	}
+	iss.validator = gois.NewValidator(configuration, nil)
+	return iss
+}
+
+// brokenIssuer reject every token with err, used when config cannot be loaded
+func brokenIssuer(cfg ConfigAuth, extractor gois.RequestTokenExtractor, err error) *issuer {
+	keys := gois.SecretProviderFunc(func(*jwt.JSONWebToken) (interface{}, error) {
+		return nil, err
+	})
+	configuration := gois.NewConfigurationTrustProvider(keys, cfg.Audiences, cfg.Issuer)
+	return &issuer{
+		name:      cfg.Issuer,
+		validator: gois.NewValidator(configuration, extractor),
+		temporal:  newTemporalRules(cfg),
+	}
+}
+
+// validate verify token signature, issuer and audience, time claims are checked
+// on the decoded claims by temporal
+func (iss *issuer) validate(ctx context.Context, token *jwt.JSONWebToken) error {
+	if iss.checkAlgorithm != nil {
+		if len(token.Headers) < 1 {
+			return gois.ErrNoJWTHeaders
+		}
+		if err := iss.checkAlgorithm(ctx, token.Headers[0].Algorithm); err != nil {
+			return err
+		}
+	}
+	return iss.validator.ValidateTokenWithLeeway(token, skipTimeLeeway)
+}
+
+// NewMultiIssuerAuthManager create AuthManager accepting tokens of several issuers.
+// The validator is picked from the unverified "iss" claim, tokens of unknown issuers are rejected.
+// Realm is taken from the first config.
+func NewMultiIssuerAuthManager(cfgs ...ConfigAuth) (*AuthManager, error) {
+	if len(cfgs) == 0 {
+		return nil, errors.New("auth: no issuer configured")
+	}
+	am := &AuthManager{
+		Extractor: BearerExtractor,
+		realm:     cfgs[0].Realm,
+	}
+	seen := map[string]bool{}
+	for _, cfg := range cfgs {
+		if cfg.Issuer == "" {
+			return nil, errors.New("auth: issuer is required for multi issuer manager")
+		}
+		if seen[cfg.Issuer] {
+			return nil, fmt.Errorf("auth: duplicate issuer %q", cfg.Issuer)
+		}
+		seen[cfg.Issuer] = true
+		iss, err := newIssuer(cfg, gois.RequestTokenExtractorFunc(am.extractToken))
+		if err != nil {
+			return nil, err
+		}
+		am.issuers = append(am.issuers, iss)
+	}
+	am.Validator = am.issuers[0].validator
+	return am, nil
+}
+
+// issuerFor pick issuer validating token, single issuer managers skip the lookup
+// and let validation report issuer mismatch. AuthManager built as a literal
+// validate with its Validator and default time rules
+func (am *AuthManager) issuerFor(token *jwt.JSONWebToken) (*issuer, error) {
+	if len(am.issuers) == 0 {
+		if am.Validator == nil {
+			return nil, ErrUnknownIssuer
+		}
+		return &issuer{validator: am.Validator, temporal: newTemporalRules(ConfigAuth{})}, nil
+	}
+	if len(am.issuers) == 1 {
+		return am.issuers[0], nil
+	}
+	claims := jwt.Claims{}
+	if err := token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return nil, err
+	}
+	for _, iss := range am.issuers {
+		if iss.name == claims.Issuer {
+			return iss, nil
+		}
+	}
+	return nil, ErrUnknownIssuer
+}
+
+// Close stop background work of the issuers key providers
+func (am *AuthManager) Close() {
+	for _, iss := range am.issuers {
+		if iss.jwks != nil {
+			iss.jwks.Close()
+		}
+	}
+}
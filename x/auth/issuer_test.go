@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/flyznex/gois"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestMultiIssuerAuthManager(t *testing.T) {
+	oldKey := genRSASSAJWK(jose.RS256, "old")
+	newKey := genECDSAJWK(jose.ES384, "new")
+	oldIdP := newTestJWKSServer(oldKey)
+	defer oldIdP.Close()
+	newIdP := newTestJWKSServer(newKey)
+	defer newIdP.Close()
+
+	am, err := NewMultiIssuerAuthManager(
+		ConfigAuth{Issuer: "old-idp", Audiences: defaultAudience, IdentityServerURI: oldIdP.URL},
+		ConfigAuth{Issuer: "new-idp", Audiences: defaultAudience, IdentityServerURI: newIdP.URL, MethodSignature: "ES384", RoleClaims: []string{"realm_access.roles"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := am.Authenticate()(RequireRoles("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	oldClaims := defaultTestClaims()
+	oldClaims.Issuer = "old-idp"
+	newClaims := defaultTestClaims()
+	newClaims.Issuer = "new-idp"
+	unknownClaims := defaultTestClaims()
+	unknownClaims.Issuer = "unknown-idp"
+	var tests = []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"old issuer", signTestToken(oldKey, oldClaims, map[string]interface{}{"role": "admin"}), 200},
+		{"new issuer", signTestToken(newKey, newClaims, map[string]interface{}{"realm_access": map[string]interface{}{"roles": []string{"admin"}}}), 200},
+		{"new issuer role mapping", signTestToken(newKey, newClaims, map[string]interface{}{"role": "admin"}), 403},
+		{"key of other issuer", signTestToken(oldKey, newClaims), 401},
+		{"unknown issuer", signTestToken(oldKey, unknownClaims), 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.status {
+				t.Errorf("unexpected status %d", rr.Code)
+			}
+		})
+	}
+
+	if _, err := NewMultiIssuerAuthManager(ConfigAuth{Issuer: "a"}, ConfigAuth{Issuer: "a"}); err == nil {
+		t.Error("expected duplicate issuer error")
+	}
+}
+
+func TestAuthManagerLiteralValidator(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	keys := NewJWKSProvider(JWKSOptions{URI: ts.URL})
+	defer keys.Close()
+	configuration := gois.NewConfiguration(keys, defaultAudience, defaultIssuer, jose.RS256)
+	am := &AuthManager{Validator: gois.NewValidator(configuration, nil)}
+
+	expired := defaultTestClaims()
+	expired.Expiry = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	other := defaultTestClaims()
+	other.Issuer = "other"
+	var tests = []struct {
+		name   string
+		claims jwt.Claims
+		want   int
+	}{
+		{"valid", defaultTestClaims(), http.StatusOK},
+		{"expired", expired, http.StatusUnauthorized},
+		{"wrong issuer", other, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serveWithToken(am.Authenticate()(okHandler), signTestToken(key, tt.claims)); got != tt.want {
+				t.Errorf("unexpected status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/flyznex/gois"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// JWKS provider defaults
+const (
+	DefaultJWKSCacheTTL           = time.Hour
+	DefaultJWKSMinRefetchInterval = 30 * time.Second
+)
+
+// Reasons reported in JWKSFetchEvent
+const (
+	FetchInitial    = "initial"
+	FetchExpired    = "expired"
+	FetchUnknownKID = "unknown_kid"
+	FetchBackground = "background"
+)
+
+// ErrNoJWKS returned when JWKS endpoint returned no key
+var ErrNoJWKS = errors.New("jwks endpoint returned no key")
+
+type (
+	// JWKSOptions configure JWKSProvider
+	JWKSOptions struct {
+		// URI of the JWKS endpoint, ignored when Discovery is set
+		URI string
+		// Discovery resolve jwks_uri from OpenID provider metadata
+		Discovery *Discovery
+		Client    *http.Client
+		// CacheTTL time keys are considered fresh, default DefaultJWKSCacheTTL
+		CacheTTL time.Duration
+		// RefreshInterval refresh keys in background, disabled when zero
+		RefreshInterval time.Duration
+		// MinRefetchInterval minimum time between fetches triggered by unknown kid,
+		// default DefaultJWKSMinRefetchInterval
+		MinRefetchInterval time.Duration
+		// OnFetch called after every fetch attempt
+		OnFetch func(JWKSFetchEvent)
+		// Clock return current time, default time.Now
+		Clock func() time.Time
+	}
+	// JWKSFetchEvent outcome of a JWKS fetch
+	JWKSFetchEvent struct {
+		URI      string
+		Reason   string
+		Keys     int
+		Duration time.Duration
+		Err      error
+	}
+	// JWKSStats counters of JWKSProvider
+	JWKSStats struct {
+		Fetches     int64
+		Errors      int64
+		StaleServed int64
+		LastFetch   time.Time
+		LastError   error
+	}
+	// JWKSProvider cache keys of a JWKS endpoint, implements gois.SecretProvider
+	JWKSProvider struct {
+		opts JWKSOptions
+
+		mu          sync.RWMutex
+		keys        []jose.JSONWebKey
+		fetchedAt   time.Time
+		lastAttempt time.Time
+		stats       JWKSStats
+		// inflight closed when the running fetch completes, nil when none runs
+		inflight chan struct{}
+
+		done chan struct{}
+		once sync.Once
+	}
+)
+
+// NewJWKSProvider create JWKSProvider, background refresh starts when
+// RefreshInterval is set and runs until Close. Default client time out after
+// DefaultHTTPTimeout
+func NewJWKSProvider(opts JWKSOptions) *JWKSProvider {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: DefaultHTTPTimeout}
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = DefaultJWKSCacheTTL
+	}
+	if opts.MinRefetchInterval <= 0 {
+		opts.MinRefetchInterval = DefaultJWKSMinRefetchInterval
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	p := &JWKSProvider{opts: opts, done: make(chan struct{})}
+	if opts.RefreshInterval > 0 {
+		go p.refreshLoop()
+	}
+	return p
+}
+
+// GetSecret implements gois.SecretProvider
+func (p *JWKSProvider) GetSecret(token *jwt.JSONWebToken) (interface{}, error) {
+	if len(token.Headers) < 1 {
+		return nil, gois.ErrNoJWTHeaders
+	}
+	return p.Key(token.Headers[0].KeyID)
+}
+
+// Key return key with given kid. Expired keys are served stale while a single
+// background fetch refresh them. Unknown kid triggers a refetch, all fetches
+// but the first one are rate limited by MinRefetchInterval.
+func (p *JWKSProvider) Key(kid string) (jose.JSONWebKey, error) {
+	now := p.opts.Clock()
+	p.mu.RLock()
+	key, found := findKey(p.keys, kid)
+	fresh := !p.fetchedAt.IsZero() && now.Sub(p.fetchedAt) < p.opts.CacheTTL
+	empty := p.keys == nil
+	canRefetch := now.Sub(p.lastAttempt) >= p.opts.MinRefetchInterval
+	lastErr := p.stats.LastError
+	p.mu.RUnlock()
+
+	switch {
+	case found && fresh:
+		return key, nil
+	case found:
+		p.mu.Lock()
+		p.stats.StaleServed++
+		p.mu.Unlock()
+		if canRefetch {
+			p.refreshAsync(FetchExpired)
+		}
+		return key, nil
+	case empty && !canRefetch:
+		return jose.JSONWebKey{}, lastErr
+	case empty:
+		if err := p.refresh(FetchInitial); err != nil {
+			return jose.JSONWebKey{}, err
+		}
+	case canRefetch:
+		if err := p.refresh(FetchUnknownKID); err != nil {
+			return jose.JSONWebKey{}, gois.ErrNoKeyFound
+		}
+	default:
+		return jose.JSONWebKey{}, gois.ErrNoKeyFound
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if key, found := findKey(p.keys, kid); found {
+		return key, nil
+	}
+	return jose.JSONWebKey{}, gois.ErrNoKeyFound
+}
+
+// Refresh fetch keys now
+func (p *JWKSProvider) Refresh() error {
+	return p.refresh(FetchBackground)
+}
+
+// Stats return fetch counters
+func (p *JWKSProvider) Stats() JWKSStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.stats
+}
+
+// Close stop background refresh
+func (p *JWKSProvider) Close() {
+	p.once.Do(func() { close(p.done) })
+}
+
+func (p *JWKSProvider) refreshLoop() {
+	t := time.NewTicker(p.opts.RefreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.refresh(FetchBackground)
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// refresh fetch keys, concurrent callers share a single fetch
+func (p *JWKSProvider) refresh(reason string) error {
+	p.mu.Lock()
+	done := p.inflight
+	if done == nil {
+		p.inflight = make(chan struct{})
+		p.mu.Unlock()
+		return p.update(reason)
+	}
+	p.mu.Unlock()
+	<-done
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.stats.LastError
+}
+
+// refreshAsync fetch keys in background unless a fetch is running
+func (p *JWKSProvider) refreshAsync(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inflight != nil {
+		return
+	}
+	p.inflight = make(chan struct{})
+	go p.update(reason)
+}
+
+// update run the fetch started by refresh or refreshAsync and release callers
+// waiting on inflight
+func (p *JWKSProvider) update(reason string) error {
+	start := time.Now()
+	uri, keys, err := p.fetch()
+	event := JWKSFetchEvent{URI: uri, Reason: reason, Keys: len(keys), Duration: time.Since(start), Err: err}
+
+	now := p.opts.Clock()
+	p.mu.Lock()
+	p.lastAttempt = now
+	p.stats.Fetches++
+	p.stats.LastFetch = p.lastAttempt
+	p.stats.LastError = err
+	if err != nil {
+		p.stats.Errors++
+	} else {
+		p.keys, p.fetchedAt = keys, p.lastAttempt
+	}
+	close(p.inflight)
+	p.inflight = nil
+	p.mu.Unlock()
+
+	if p.opts.OnFetch != nil {
+		p.opts.OnFetch(event)
+	}
+	return err
+}
+
+func (p *JWKSProvider) fetch() (string, []jose.JSONWebKey, error) {
+	uri := p.opts.URI
+	if p.opts.Discovery != nil {
+		m, err := p.opts.Discovery.Metadata()
+		if err != nil {
+			return "", nil, err
+		}
+		uri = m.JWKSURI
+	}
+	resp, err := p.opts.Client.Get(uri)
+	if err != nil {
+		return uri, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return uri, nil, fmt.Errorf("jwks: unexpected status %d", resp.StatusCode)
+	}
+	jwks := gois.JWKS{}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return uri, nil, err
+	}
+	if len(jwks.Keys) == 0 {
+		return uri, nil, ErrNoJWKS
+	}
+	return uri, jwks.Keys, nil
+}
+
+// findKey lookup key by kid, a token without kid matches a single-key set
+func findKey(keys []jose.JSONWebKey, kid string) (jose.JSONWebKey, bool) {
+	for _, k := range keys {
+		if k.KeyID == kid {
+			return k, true
+		}
+	}
+	if kid == "" && len(keys) == 1 {
+		return keys[0], true
+	}
+	return jose.JSONWebKey{}, false
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	auth0 "github.com/auth0-community/go-auth0"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// rotatingJWKS JWKS endpoint whose keys and availability can be changed
+type rotatingJWKS struct {
+	mu    sync.Mutex
+	keys  []jose.JSONWebKey
+	down  bool
+	calls int
+}
+
+func (s *rotatingJWKS) set(down bool, keys ...jose.JSONWebKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down, s.keys = down, nil
+	for _, k := range keys {
+		s.keys = append(s.keys, k.Public())
+	}
+}
+
+func (s *rotatingJWKS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.down {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(auth0.JWKS{Keys: s.keys})
+}
+
+// testClock clock moved forward by the test
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Now()}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestJWKSProviderRotation(t *testing.T) {
+	k1 := genRSASSAJWK(jose.RS256, "k1")
+	k2 := genRSASSAJWK(jose.RS256, "k2")
+	jwks := &rotatingJWKS{}
+	jwks.set(false, k1)
+	ts := httptest.NewServer(jwks)
+	defer ts.Close()
+
+	var (
+		mu     sync.Mutex
+		events []JWKSFetchEvent
+	)
+	clock := newTestClock()
+	p := NewJWKSProvider(JWKSOptions{
+		URI:                ts.URL,
+		CacheTTL:           time.Minute,
+		MinRefetchInterval: 10 * time.Second,
+		OnFetch: func(e JWKSFetchEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		},
+		Clock: clock.Now,
+	})
+	defer p.Close()
+
+	if _, err := p.Key("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Key("k1"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(events) != 1 || events[0].Reason != FetchInitial || events[0].Keys != 1 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	mu.Unlock()
+
+	// unknown kid is rate limited by MinRefetchInterval
+	jwks.set(false, k1, k2)
+	if _, err := p.Key("k2"); err == nil {
+		t.Error("expected rate limited refetch")
+	}
+
+	// expired keys are served stale while endpoint is down
+	clock.Add(2 * time.Minute)
+	jwks.set(true)
+	if _, err := p.Key("k1"); err != nil {
+		t.Errorf("expected stale key, got %v", err)
+	}
+	waitFetches(t, p, 2)
+	stats := p.Stats()
+	if stats.StaleServed != 1 || stats.Errors != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// endpoint is back, expired keys are replaced by rotated set
+	jwks.set(false, k2)
+	clock.Add(15 * time.Second)
+	if _, err := p.Key("k2"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := p.Key("k1"); err == nil {
+		t.Error("expected rotated key to be gone")
+	}
+}
+
+// waitFetches wait for background fetches until p made n fetches
+func waitFetches(t *testing.T, p *JWKSProvider, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Stats().Fetches < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d fetches, got %d", n, p.Stats().Fetches)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestJWKSProviderServeStaleWhileRefreshing(t *testing.T) {
+	k1 := genRSASSAJWK(jose.RS256, "k1")
+	var calls int32
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			select {
+			case <-hang:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(auth0.JWKS{Keys: []jose.JSONWebKey{k1.Public()}})
+	}))
+	defer ts.Close()
+	defer close(hang)
+
+	clock := newTestClock()
+	p := NewJWKSProvider(JWKSOptions{URI: ts.URL, Clock: clock.Now})
+	defer p.Close()
+	if _, err := p.Key("k1"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(DefaultJWKSCacheTTL)
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 5; i++ {
+			if _, err := p.Key("k1"); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callers blocked on the refresh")
+	}
+	if n := p.Stats().StaleServed; n != 5 {
+		t.Errorf("expected stale key served 5 times, got %d", n)
+	}
+	if n := atomic.LoadInt32(&calls); n > 2 {
+		t.Errorf("expected a single background refresh, got %d fetches", n)
+	}
+}
+
+func TestJWKSProviderUnknownKID(t *testing.T) {
+	k1 := genRSASSAJWK(jose.RS256, "k1")
+	k2 := genRSASSAJWK(jose.RS256, "k2")
+	jwks := &rotatingJWKS{}
+	jwks.set(false, k1)
+	ts := httptest.NewServer(jwks)
+	defer ts.Close()
+
+	clock := newTestClock()
+	p := NewJWKSProvider(JWKSOptions{URI: ts.URL, Clock: clock.Now})
+	defer p.Close()
+	if _, err := p.Key("k1"); err != nil {
+		t.Fatal(err)
+	}
+	jwks.set(false, k1, k2)
+	clock.Add(DefaultJWKSMinRefetchInterval)
+	if _, err := p.Key("k2"); err != nil {
+		t.Errorf("expected refetch on unknown kid, got %v", err)
+	}
+}
+
+func TestJWKSProviderBackgroundRefresh(t *testing.T) {
+	jwks := &rotatingJWKS{}
+	jwks.set(false, genRSASSAJWK(jose.RS256, "k1"))
+	ts := httptest.NewServer(jwks)
+	defer ts.Close()
+
+	p := NewJWKSProvider(JWKSOptions{URI: ts.URL, RefreshInterval: time.Millisecond})
+	defer p.Close()
+	waitFetches(t, p, 3)
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+)
+
+// ErrCertificateBinding returned when the access token is not bound to the client certificate
+var ErrCertificateBinding = errors.New("token is not bound to the client certificate")
+
+// verifyCertificateBinding check the cnf "x5t#S256" claim against the SHA-256
+// thumbprint of the client certificate (RFC 8705 section 3), nil cert never match.
+// Tokens without the claim are rejected only when required
+func verifyCertificateBinding(cert *x509.Certificate, claims map[string]interface{}, required bool) error {
+	x5t := confirmation(claims, "x5t#S256")
+	if x5t == "" {
+		if required {
+			return ErrCertificateBinding
+		}
+		return nil
+	}
+	if cert == nil {
+		return ErrCertificateBinding
+	}
+	sum := sha256.Sum256(cert.Raw)
+	if x5t != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		return ErrCertificateBinding
+	}
+	return nil
+}
+
+// peerCertificate return the client certificate of a TLS connection, nil without one
+func peerCertificate(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func genTestCertificate(t *testing.T, cn string) *x509.Certificate {
+	return genTestTLSCertificate(t, cn).Leaf
+}
+
+func genTestTLSCertificate(t *testing.T, cn string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+func TestCertificateBinding(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	partner := genTestCertificate(t, "partner")
+	other := genTestCertificate(t, "other")
+	sum := sha256.Sum256(partner.Raw)
+	bound := signTestToken(key, defaultTestClaims(), map[string]interface{}{
+		"cnf": map[string]interface{}{"x5t#S256": base64.RawURLEncoding.EncodeToString(sum[:])},
+	})
+	unbound := signTestToken(key, defaultTestClaims())
+
+	var tests = []struct {
+		name     string
+		required bool
+		token    string
+		cert     *x509.Certificate
+		want     int
+	}{
+		{"matching certificate", true, bound, partner, 200},
+		{"other certificate", true, bound, other, 401},
+		{"no client certificate", true, bound, nil, 401},
+		{"unbound token", true, unbound, partner, 401},
+		{"bound token not required", false, bound, partner, 200},
+		{"bound token other certificate not required", false, bound, other, 401},
+		{"bound token as bearer not required", false, bound, nil, 401},
+		{"unbound token not required", false, unbound, nil, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			am := NewAuthManager(ConfigAuth{Issuer: defaultIssuer, Audiences: defaultAudience, IdentityServerURI: ts.URL})
+			am.RequireCertificateBinding = tt.required
+			req := httptest.NewRequest("GET", "https://api.example.com/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.cert != nil {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}}
+			}
+			rr := httptest.NewRecorder()
+			am.Authenticate()(okHandler).ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("unexpected status %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCertificateBindingGRPC(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{Issuer: defaultIssuer, Audiences: defaultAudience, IdentityServerURI: ts.URL})
+	am.RequireCertificateBinding = true
+
+	serverCert := genTestTLSCertificate(t, "server")
+	clientCert := genTestTLSCertificate(t, "partner")
+	client, stop := dialTestHealth(t, am,
+		&tls.Config{Certificates: []tls.Certificate{serverCert}, ClientAuth: tls.RequireAnyClientCert},
+		&tls.Config{Certificates: []tls.Certificate{clientCert}, InsecureSkipVerify: true})
+	defer stop()
+
+	sum := sha256.Sum256(clientCert.Leaf.Raw)
+	bound := signTestToken(key, defaultTestClaims(), map[string]interface{}{
+		"cnf": map[string]interface{}{"x5t#S256": base64.RawURLEncoding.EncodeToString(sum[:])},
+	})
+	var tests = []struct {
+		name  string
+		token string
+		want  codes.Code
+	}{
+		{"bound token", bound, codes.OK},
+		{"unbound token", signTestToken(key, defaultTestClaims()), codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+tt.token)
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("unexpected code %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCertificateBindingAMQP(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{Issuer: defaultIssuer, Audiences: defaultAudience, IdentityServerURI: ts.URL})
+	am.RequireCertificateBinding = true
+	handled := false
+	h := am.AMQPHandler(AMQPOptions{OnError: func(amqp.Delivery, *AuthError) {}}, func(context.Context, amqp.Delivery) { handled = true })
+	h(amqp.Delivery{Headers: amqp.Table{"Authorization": "Bearer " + signTestToken(key, defaultTestClaims())}})
+	if handled {
+		t.Error("expected delivery to be rejected when certificate binding is required")
+	}
+
+	am.RequireCertificateBinding = false
+	bound := signTestToken(key, defaultTestClaims(), map[string]interface{}{
+		"cnf": map[string]interface{}{"x5t#S256": "thumbprint"},
+	})
+	h(amqp.Delivery{Headers: amqp.Table{"Authorization": "Bearer " + bound}})
+	if handled {
+		t.Error("expected certificate-bound token to be rejected without certificate")
+	}
+}
@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/go-chi/chi"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Policy effects
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+type (
+	// Effect of a matching policy rule
+	Effect string
+	// Policy ordered authorization rules, the first matching rule decides.
+	// Requests matching no rule get Default, deny when not set
+	Policy struct {
+		Default Effect `json:"default" yaml:"default"`
+		Rules   []Rule `json:"rules" yaml:"rules"`
+	}
+	// Rule match when every condition set holds. Values of Claims, Params and Headers
+	// are alternatives, "*" match any present value and "${claim:path}", "${param:name}",
+	// "${header:name}" are replaced by the request attribute, e.g. a rule with
+	// Params {"id": ["${claim:sub}"]} only match requests on the caller's own resource
+	Rule struct {
+		Name   string `json:"name" yaml:"name"`
+		Effect Effect `json:"effect" yaml:"effect"`
+		// Methods any of, empty match all methods
+		Methods []string `json:"methods" yaml:"methods"`
+		// Roles any of
+		Roles []string `json:"roles" yaml:"roles"`
+		// Scopes all of
+		Scopes []string `json:"scopes" yaml:"scopes"`
+		// Claims claim path to allowed values
+		Claims map[string][]string `json:"claims" yaml:"claims"`
+		// Params chi URL param to allowed values
+		Params map[string][]string `json:"params" yaml:"params"`
+		// Headers request header to allowed values
+		Headers map[string][]string `json:"headers" yaml:"headers"`
+	}
+	// Decision result of a policy evaluation, Rule is empty when Default applied
+	Decision struct {
+		Effect Effect
+		Rule   string
+	}
+	// PolicyTestCase request and identity a policy is evaluated against
+	PolicyTestCase struct {
+		Name    string                 `json:"name" yaml:"name"`
+		Method  string                 `json:"method" yaml:"method"`
+		Params  map[string]string      `json:"params" yaml:"params"`
+		Headers map[string]string      `json:"headers" yaml:"headers"`
+		Claims  map[string]interface{} `json:"claims" yaml:"claims"`
+		// Roles and Scopes merged into the ones read from Claims
+		Roles  []string `json:"roles" yaml:"roles"`
+		Scopes []string `json:"scopes" yaml:"scopes"`
+		Expect Effect   `json:"expect" yaml:"expect"`
+	}
+	// PolicyTestResult outcome of a PolicyTestCase
+	PolicyTestResult struct {
+		Case     PolicyTestCase
+		Decision Decision
+		Passed   bool
+	}
+)
+
+// LoadPolicy read policy from a YAML or JSON file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy parse and validate a YAML or JSON policy
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, fmt.Errorf("policy: %v", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate check effects of the policy and its rules
+func (p *Policy) Validate() error {
+	if p.Default != "" && p.Default != Allow && p.Default != Deny {
+		return fmt.Errorf("policy: invalid default effect %q", p.Default)
+	}
+	for i, rule := range p.Rules {
+		if rule.Effect != Allow && rule.Effect != Deny {
+			return fmt.Errorf("policy: rule %d %q: invalid effect %q", i, rule.Name, rule.Effect)
+		}
+	}
+	return nil
+}
+
+// Evaluate return the decision of the first rule matching request r, whose context
+// carry the values stored by the authentication middlewares
+func (p *Policy) Evaluate(r *http.Request) Decision {
+	for i, rule := range p.Rules {
+		if rule.match(r) {
+			name := rule.Name
+			if name == "" {
+				name = fmt.Sprintf("rule %d", i)
+			}
+			return Decision{Effect: rule.Effect, Rule: name}
+		}
+	}
+	if p.Default == Allow {
+		return Decision{Effect: Allow}
+	}
+	return Decision{Effect: Deny}
+}
+
+// Authorize middleware evaluate policy after authentication, mount it with
+// chi Router.With or inside a route so URL params are resolved
+func (p *Policy) Authorize() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		hfn := func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Value(IdentityKey).(map[string]interface{}); !ok {
+				respond(w, r, errMissingToken())
+				return
+			}
+			if d := p.Evaluate(r); d.Effect != Allow {
+				respond(w, r, errInsufficientScope("denied by policy"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(hfn)
+	}
+}
+
+// LoadPolicyTests read policy test cases from a YAML or JSON file
+func LoadPolicyTests(path string) ([]PolicyTestCase, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []PolicyTestCase
+	if err := yaml.UnmarshalStrict(data, &cases); err != nil {
+		return nil, fmt.Errorf("policy tests: %v", err)
+	}
+	return cases, nil
+}
+
+// Test evaluate policy against every case, a case pass when the decision effect
+// equals Expect
+func (p *Policy) Test(cases []PolicyTestCase) []PolicyTestResult {
+	results := make([]PolicyTestResult, 0, len(cases))
+	for _, c := range cases {
+		d := p.Evaluate(c.request())
+		results = append(results, PolicyTestResult{Case: c, Decision: d, Passed: d.Effect == c.Expect})
+	}
+	return results
+}
+
+// request build the request a test case describe
+func (c PolicyTestCase) request() *http.Request {
+	method := c.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	r := httptest.NewRequest(method, "/", nil)
+	for k, v := range c.Headers {
+		r.Header.Set(k, v)
+	}
+	rctx := chi.NewRouteContext()
+	for k, v := range c.Params {
+		rctx.URLParams.Add(k, v)
+	}
+	claims := normalizeClaims(c.Claims)
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+	ctx = contextWithClaims(ctx, claims, claimMapping{})
+	roles := GetRolesFromContext(ctx)
+	for _, role := range c.Roles {
+		roles[role] = role
+	}
+	scopes := GetScopesFromContext(ctx)
+	for _, s := range c.Scopes {
+		scopes[s] = s
+	}
+	return r.WithContext(ctx)
+}
+
+func (rule Rule) match(r *http.Request) bool {
+	if len(rule.Methods) > 0 && !containsFold(rule.Methods, r.Method) {
+		return false
+	}
+	ctx := r.Context()
+	if len(rule.Roles) > 0 {
+		roles := GetRolesFromContext(ctx)
+		matched := false
+		for _, role := range rule.Roles {
+			if _, ok := roles[role]; ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	scopes := GetScopesFromContext(ctx)
+	for _, s := range rule.Scopes {
+		if _, ok := scopes[s]; !ok {
+			return false
+		}
+	}
+	claims, _ := ctx.Value(IdentityKey).(map[string]interface{})
+	for path, want := range rule.Claims {
+		v, _ := lookupClaim(claims, path)
+		if !matchValues(r, claims, claimValues(v), want) {
+			return false
+		}
+	}
+	for name, want := range rule.Params {
+		if !matchValues(r, claims, nonEmpty(chi.URLParam(r, name)), want) {
+			return false
+		}
+	}
+	for name, want := range rule.Headers {
+		if !matchValues(r, claims, r.Header.Values(name), want) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchValues report whether one of the actual values equal one of the allowed values
+func matchValues(r *http.Request, claims map[string]interface{}, actual, allowed []string) bool {
+	if len(actual) == 0 {
+		return false
+	}
+	for _, a := range allowed {
+		if a == "*" {
+			return true
+		}
+		for _, want := range expandValue(r, claims, a) {
+			for _, v := range actual {
+				if v == want {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// expandValue resolve "${claim:path}", "${param:name}" and "${header:name}" references
+func expandValue(r *http.Request, claims map[string]interface{}, v string) []string {
+	if !strings.HasPrefix(v, "${") || !strings.HasSuffix(v, "}") {
+		return []string{v}
+	}
+	ref := strings.SplitN(v[2:len(v)-1], ":", 2)
+	if len(ref) != 2 {
+		return []string{v}
+	}
+	switch ref[0] {
+	case "claim":
+		c, _ := lookupClaim(claims, ref[1])
+		return claimValues(c)
+	case "param":
+		return nonEmpty(chi.URLParam(r, ref[1]))
+	case "header":
+		return r.Header.Values(ref[1])
+	}
+	return []string{v}
+}
+
+// claimValues return claim values as strings, scalars are formatted
+func claimValues(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string, []string, []interface{}:
+		return claimStrings(v)
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+// normalizeClaims convert YAML decoded maps to the form of JSON decoded claims
+func normalizeClaims(claims map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		out[k] = normalizeClaim(v)
+	}
+	return out
+}
+
+func normalizeClaim(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, vv := range v {
+			m[fmt.Sprint(k)] = normalizeClaim(vv)
+		}
+		return m
+	case map[string]interface{}:
+		return normalizeClaims(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeClaim(v[i])
+		}
+		return v
+	case int:
+		return float64(v)
+	}
+	return v
+}
+
+func nonEmpty(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return []string{v}
+}
+
+func containsFold(values []string, v string) bool {
+	for _, s := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+const testPolicy = `
+default: deny
+rules:
+  - name: admins
+    effect: allow
+    roles: [admin]
+  - name: suspended
+    effect: deny
+    claims:
+      status: [suspended]
+  - name: own profile
+    effect: allow
+    methods: [GET, PUT]
+    scopes: [profile]
+    params:
+      id: ["${claim:sub}"]
+  - name: tenant read
+    effect: allow
+    methods: [GET]
+    headers:
+      X-Tenant: ["${claim:org.id}"]
+`
+
+func TestParsePolicy(t *testing.T) {
+	if _, err := ParsePolicy([]byte(testPolicy)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePolicy([]byte(`{"rules": [{"name": "x", "effect": "permit"}]}`)); err == nil {
+		t.Error("expected invalid effect error")
+	}
+	if _, err := ParsePolicy([]byte(`{"rules": [{"name": "x", "effect": "allow", "role": ["a"]}]}`)); err == nil {
+		t.Error("expected unknown field error")
+	}
+	p, err := ParsePolicy([]byte(`{"default": "allow", "rules": [{"effect": "deny", "methods": ["DELETE"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := p.Evaluate(httptest.NewRequest("DELETE", "/", nil)); d.Effect != Deny || d.Rule != "rule 0" {
+		t.Errorf("unexpected decision %+v", d)
+	}
+}
+
+func TestPolicyRunner(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy_test.yaml")
+	err = ioutil.WriteFile(path, []byte(`
+- name: admin can delete anything
+  method: DELETE
+  roles: [admin]
+  expect: allow
+- name: user reads own profile
+  params: {id: "42"}
+  claims: {sub: "42", scope: "profile"}
+  expect: allow
+- name: user cannot read other profile
+  params: {id: "43"}
+  claims: {sub: "42", scope: "profile"}
+  expect: deny
+- name: suspended user cannot read own profile
+  params: {id: "42"}
+  claims: {sub: "42", scope: "profile", status: suspended}
+  expect: deny
+- name: tenant member reads tenant
+  headers: {X-Tenant: acme}
+  claims: {org: {id: acme}}
+  expect: allow
+- name: tenant member cannot write tenant
+  method: POST
+  headers: {X-Tenant: acme}
+  claims: {org: {id: acme}}
+  expect: deny
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases, err := LoadPolicyTests(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 6 {
+		t.Fatalf("unexpected cases %d", len(cases))
+	}
+	for _, res := range p.Test(cases) {
+		if !res.Passed {
+			t.Errorf("%s: got %s by %q, want %s", res.Case.Name, res.Decision.Effect, res.Decision.Rule, res.Case.Expect)
+		}
+	}
+}
+
+func TestPolicyAuthorize(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := chi.NewRouter()
+	r.With(p.Authorize()).Get("/users/{id}", okHandler.ServeHTTP)
+	var tests = []struct {
+		name   string
+		path   string
+		claims map[string]interface{}
+		want   int
+	}{
+		{"anonymous", "/users/42", nil, 401},
+		{"own profile", "/users/42", map[string]interface{}{"sub": "42", "scope": "profile"}, 200},
+		{"other profile", "/users/43", map[string]interface{}{"sub": "42", "scope": "profile"}, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.claims != nil {
+				req = req.WithContext(contextWithClaims(context.Background(), tt.claims, claimMapping{}))
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("unexpected status %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrNoPrincipal returned when context carries no authenticated principal
+var ErrNoPrincipal = errors.New("no authenticated principal in context")
+
+// Principal authenticated caller built from token claims
+type Principal struct {
+	Subject   string
+	Name      string
+	Email     string
+	Roles     []string
+	Scopes    []string
+	Tenant    string
+	Issuer    string
+	Audience  []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// Claims raw claims of the token
+	Claims map[string]interface{}
+}
+
+func newPrincipal(claims map[string]interface{}, roles, scopes map[string]string, m claimMapping) *Principal {
+	return &Principal{
+		Subject:   stringClaim(claims, "sub"),
+		Name:      stringClaim(claims, "name"),
+		Email:     stringClaim(claims, "email"),
+		Roles:     sortedKeys(roles),
+		Scopes:    sortedKeys(scopes),
+		Tenant:    m.tenant(claims),
+		Issuer:    stringClaim(claims, "iss"),
+		Audience:  claimStrings(claims["aud"]),
+		IssuedAt:  timeClaim(claims, "iat"),
+		ExpiresAt: timeClaim(claims, "exp"),
+		Claims:    claims,
+	}
+}
+
+// PrincipalFromContext return principal stored by the authentication middlewares
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(PrincipalKey).(*Principal)
+	return p, ok && p != nil
+}
+
+// HasRole report whether principal has role
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+// HasScope report whether principal was granted scope
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+// Decode unmarshal raw claims into v, a struct with json tags
+func (p *Principal) Decode(v interface{}) error {
+	data, err := json.Marshal(p.Claims)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// DecodeClaims unmarshal claims of the principal in context into v
+func DecodeClaims(ctx context.Context, v interface{}) error {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return ErrNoPrincipal
+	}
+	return p.Decode(v)
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// timeClaim read NumericDate claim, JSON numbers are decoded as float64 and json.Number
+func timeClaim(claims map[string]interface{}, name string) time.Time {
+	switch v := claims[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0)
+	case int64:
+		return time.Unix(v, 0)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return time.Unix(n, 0)
+		}
+	}
+	return time.Time{}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
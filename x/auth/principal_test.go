@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestPrincipalFromContext(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{
+		Issuer:            defaultIssuer,
+		Audiences:         defaultAudience,
+		IdentityServerURI: ts.URL,
+		TenantClaim:       "org.id",
+	})
+	type user struct {
+		Email       string `json:"email"`
+		Department  string `json:"department"`
+		EmployeeNum int    `json:"employee_number"`
+	}
+	token := signTestToken(key, defaultTestClaims(), map[string]interface{}{
+		"name":            "Jane",
+		"email":           "jane@example.com",
+		"role":            []string{"user", "admin"},
+		"scope":           "read write",
+		"org":             map[string]interface{}{"id": "acme"},
+		"department":      "R&D",
+		"employee_number": 42,
+	})
+	var got *Principal
+	var decoded user
+	h := am.Authenticate()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		if got, ok = PrincipalFromContext(r.Context()); !ok {
+			t.Fatal("expected principal in context")
+		}
+		if err := DecodeClaims(r.Context(), &decoded); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	if status := serveWithToken(h, token); status != 200 {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if got.Subject != "user-id" || got.Name != "Jane" || got.Email != "jane@example.com" || got.Tenant != "acme" || got.Issuer != defaultIssuer {
+		t.Errorf("unexpected principal %+v", got)
+	}
+	if !got.HasRole("admin") || !got.HasScope("write") || got.HasRole("manager") {
+		t.Errorf("unexpected roles %v scopes %v", got.Roles, got.Scopes)
+	}
+	if got.ExpiresAt.IsZero() || got.IssuedAt.IsZero() {
+		t.Errorf("expected iat and exp, got %v %v", got.IssuedAt, got.ExpiresAt)
+	}
+	if decoded != (user{Email: "jane@example.com", Department: "R&D", EmployeeNum: 42}) {
+		t.Errorf("unexpected decoded claims %+v", decoded)
+	}
+}
+
+func TestContextAccessorsDoNotPanic(t *testing.T) {
+	ctx := context.WithValue(context.Background(), IdentityKey, map[string]interface{}{"name": 42})
+	ctx = context.WithValue(ctx, UserIDKey, 42)
+	if GetUserNameFromContext(ctx) != "" || GetUserIDFromContext(ctx) != "" {
+		t.Error("expected empty values for unexpected claim types")
+	}
+	if _, ok := PrincipalFromContext(context.Background()); ok {
+		t.Error("unexpected principal")
+	}
+	if err := DecodeClaims(context.Background(), &struct{}{}); err != ErrNoPrincipal {
+		t.Errorf("unexpected error %v", err)
+	}
+}
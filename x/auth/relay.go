@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrHostNotAllowed returned when relaying a token to a host missing from the allowlist
+var ErrHostNotAllowed = errors.New("token relay: host not allowed")
+
+// RelayTransport RoundTripper forwarding the bearer token stored under JWTToken in the
+// request context to downstream services. Requests without token are sent as-is,
+// requests carrying a token to hosts not in AllowedHosts are refused.
+type RelayTransport struct {
+	// AllowedHosts host names (api.internal), host:port (api.internal:8443)
+	// or wildcard domains (*.svc.cluster.local) tokens can be sent to
+	AllowedHosts []string
+	// Exchange optionally swap the user token for a token dedicated to the downstream request
+	Exchange func(ctx context.Context, token string, req *http.Request) (string, error)
+	// Base transport, default http.DefaultTransport
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RelayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	relayed, err := RelayToken(req, t.AllowedHosts, t.Exchange)
+	if err != nil {
+		return nil, err
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(relayed)
+}
+
+// RelayToken return a copy of req carrying the bearer token of its context, see RelayTransport
+func RelayToken(req *http.Request, allowedHosts []string, exchange func(context.Context, string, *http.Request) (string, error)) (*http.Request, error) {
+	token, _ := req.Context().Value(JWTToken).(string)
+	if token == "" {
+		return req, nil
+	}
+	if !hostAllowed(req.URL.Host, allowedHosts) {
+		return nil, ErrHostNotAllowed
+	}
+	if exchange != nil {
+		var err error
+		if token, err = exchange(req.Context(), token, req); err != nil {
+			return nil, err
+		}
+	}
+	return withBearer(req, token), nil
+}
+
+func hostAllowed(host string, allowed []string) bool {
+	host = strings.ToLower(host)
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if _, _, err := net.SplitHostPort(a); err == nil {
+			if a == host {
+				return true
+			}
+			continue
+		}
+		if strings.HasPrefix(a, "*.") && strings.HasSuffix(name, a[1:]) {
+			return true
+		}
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
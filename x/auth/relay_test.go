@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRelayTransport(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer downstream.Close()
+	u, _ := url.Parse(downstream.URL)
+
+	var tests = []struct {
+		name      string
+		transport *RelayTransport
+		token     string
+		want      string
+		wantErr   bool
+	}{
+		{"relay", &RelayTransport{AllowedHosts: []string{u.Hostname()}}, "user-token", "Bearer user-token", false},
+		{"relay host port", &RelayTransport{AllowedHosts: []string{u.Host}}, "user-token", "Bearer user-token", false},
+		{"no token", &RelayTransport{}, "", "", false},
+		{"host not allowed", &RelayTransport{AllowedHosts: []string{"*.internal"}}, "user-token", "", true},
+		{"exchange", &RelayTransport{
+			AllowedHosts: []string{u.Hostname()},
+			Exchange: func(ctx context.Context, token string, req *http.Request) (string, error) {
+				return "exchanged-" + token, nil
+			},
+		}, "user-token", "Bearer exchanged-user-token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = context.WithValue(ctx, JWTToken, tt.token)
+			}
+			req, _ := http.NewRequest("GET", downstream.URL, nil)
+			resp, err := tt.transport.RoundTrip(req.WithContext(ctx))
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body := make([]byte, 64)
+			n, _ := resp.Body.Read(body)
+			if got := string(body[:n]); got != tt.want {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"api.internal", "billing:8443", "*.svc.cluster.local"}
+	for host, want := range map[string]bool{
+		"api.internal":             true,
+		"API.internal:80":          true,
+		"billing:8443":             true,
+		"billing:9000":             false,
+		"users.svc.cluster.local":  true,
+		"svc.cluster.local.evil":   false,
+		"evil-svc.cluster.local":   false,
+		"api.internal.example.com": false,
+	} {
+		if got := hostAllowed(host, allowed); got != want {
+			t.Errorf("%s: got %v want %v", host, got, want)
+		}
+	}
+}
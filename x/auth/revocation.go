@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultRevocationTTL time a revocation is kept when token expiry is unknown
+const DefaultRevocationTTL = 24 * time.Hour
+
+// ErrTokenRevoked returned when a validated token has been revoked
+var ErrTokenRevoked = errors.New("token is revoked")
+
+type (
+	// RevocationStore keep revoked tokens (by jti) and subjects (tokens issued before a time)
+	RevocationStore interface {
+		// RevokeToken revoke token with jti, the entry can be dropped after expiry
+		RevokeToken(jti string, expiry time.Time) error
+		// RevokeSubject revoke all tokens of sub issued before the given time. iat
+		// has whole seconds, tokens issued in the second of before stay valid
+		RevokeSubject(sub string, before time.Time) error
+		// IsRevoked report whether a token is revoked, zero issuedAt is treated as
+		// issued before any subject revocation
+		IsRevoked(jti, sub string, issuedAt time.Time) (bool, error)
+	}
+	// MemoryRevocationStore in-memory RevocationStore, entries are evicted once
+	// the tokens they cover have expired
+	MemoryRevocationStore struct {
+		subjectTTL time.Duration
+
+		mu        sync.RWMutex
+		tokens    map[string]time.Time
+		subjects  map[string]revokedSubject
+		lastSweep time.Time
+	}
+	// FileRevocationStore MemoryRevocationStore persisted to a JSON file on every change
+	FileRevocationStore struct {
+		*MemoryRevocationStore
+		path string
+		mu   sync.Mutex
+	}
+	revokedSubject struct {
+		Before  time.Time `json:"before"`
+		Expires time.Time `json:"expires"`
+	}
+	revocationSnapshot struct {
+		Tokens   map[string]time.Time      `json:"tokens"`
+		Subjects map[string]revokedSubject `json:"subjects"`
+	}
+)
+
+// NewMemoryRevocationStore create MemoryRevocationStore, subject revocations are kept
+// for subjectTTL which should be the maximum token lifetime (DefaultRevocationTTL when zero)
+func NewMemoryRevocationStore(subjectTTL time.Duration) *MemoryRevocationStore {
+	if subjectTTL <= 0 {
+		subjectTTL = DefaultRevocationTTL
+	}
+	return &MemoryRevocationStore{
+		subjectTTL: subjectTTL,
+		tokens:     map[string]time.Time{},
+		subjects:   map[string]revokedSubject{},
+	}
+}
+
+// RevokeToken implements RevocationStore
+func (s *MemoryRevocationStore) RevokeToken(jti string, expiry time.Time) error {
+	if jti == "" {
+		return errors.New("revocation: jti is required")
+	}
+	if expiry.IsZero() {
+		expiry = time.Now().Add(DefaultRevocationTTL)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[jti] = expiry
+	s.sweep()
+	return nil
+}
+
+// RevokeSubject implements RevocationStore
+func (s *MemoryRevocationStore) RevokeSubject(sub string, before time.Time) error {
+	if sub == "" {
+		return errors.New("revocation: sub is required")
+	}
+	if before.IsZero() {
+		before = time.Now()
+	}
+	before = before.Truncate(time.Second)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.subjects[sub]; ok && cur.Before.After(before) {
+		return nil
+	}
+	s.subjects[sub] = revokedSubject{Before: before, Expires: before.Add(s.subjectTTL)}
+	s.sweep()
+	return nil
+}
+
+// IsRevoked implements RevocationStore
+func (s *MemoryRevocationStore) IsRevoked(jti, sub string, issuedAt time.Time) (bool, error) {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if exp, ok := s.tokens[jti]; ok && jti != "" && now.Before(exp) {
+		return true, nil
+	}
+	if rs, ok := s.subjects[sub]; ok && sub != "" && now.Before(rs.Expires) {
+		if issuedAt.IsZero() || issuedAt.Before(rs.Before) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sweep evict expired entries at most once a minute, callers hold the lock
+func (s *MemoryRevocationStore) sweep() {
+	now := time.Now()
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for k, exp := range s.tokens {
+		if !now.Before(exp) {
+			delete(s.tokens, k)
+		}
+	}
+	for k, rs := range s.subjects {
+		if !now.Before(rs.Expires) {
+			delete(s.subjects, k)
+		}
+	}
+}
+
+func (s *MemoryRevocationStore) snapshot() revocationSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snap := revocationSnapshot{Tokens: map[string]time.Time{}, Subjects: map[string]revokedSubject{}}
+	for k, v := range s.tokens {
+		snap.Tokens[k] = v
+	}
+	for k, v := range s.subjects {
+		snap.Subjects[k] = v
+	}
+	return snap
+}
+
+// NewFileRevocationStore create FileRevocationStore loading existing revocations from path
+func NewFileRevocationStore(path string, subjectTTL time.Duration) (*FileRevocationStore, error) {
+	s := &FileRevocationStore{MemoryRevocationStore: NewMemoryRevocationStore(subjectTTL), path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snap := revocationSnapshot{}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	for k, v := range snap.Tokens {
+		s.tokens[k] = v
+	}
+	for k, v := range snap.Subjects {
+		s.subjects[k] = v
+	}
+	return s, nil
+}
+
+// RevokeToken implements RevocationStore
+func (s *FileRevocationStore) RevokeToken(jti string, expiry time.Time) error {
+	if err := s.MemoryRevocationStore.RevokeToken(jti, expiry); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// RevokeSubject implements RevocationStore
+func (s *FileRevocationStore) RevokeSubject(sub string, before time.Time) error {
+	if err := s.MemoryRevocationStore.RevokeSubject(sub, before); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// save write revocations to a temporary file renamed over path
+func (s *FileRevocationStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.Marshal(s.snapshot())
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// checkRevoked check jti, sub and iat claims of a validated token against store
+func checkRevoked(store RevocationStore, claims map[string]interface{}) error {
+	jti, _ := claims["jti"].(string)
+	sub, _ := claims["sub"].(string)
+	revoked, err := store.IsRevoked(jti, sub, timeClaim(claims, "iat"))
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// RevocationHandler admin handler revoking tokens, protect it with RequireRoles.
+// POST {"jti": "...", "expires_at": "RFC3339"} revoke a single token,
+// POST {"sub": "...", "issued_before": "RFC3339"} revoke tokens of a user issued
+// before the time (default now).
+func RevocationHandler(store RevocationStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(405), 405)
+			return
+		}
+		var req struct {
+			JTI          string    `json:"jti"`
+			ExpiresAt    time.Time `json:"expires_at"`
+			Sub          string    `json:"sub"`
+			IssuedBefore time.Time `json:"issued_before"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		var err error
+		switch {
+		case req.JTI != "" && req.Sub == "":
+			err = store.RevokeToken(req.JTI, req.ExpiresAt)
+		case req.Sub != "" && req.JTI == "":
+			err = store.RevokeSubject(req.Sub, req.IssuedBefore)
+		default:
+			http.Error(w, "exactly one of jti or sub is required", 400)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestAuthenticateRevocation(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{Issuer: defaultIssuer, Audiences: defaultAudience, IdentityServerURI: ts.URL})
+	am.Revocations = NewMemoryRevocationStore(time.Hour)
+	h := am.Authenticate()(okHandler)
+	admin := RevocationHandler(am.Revocations)
+
+	claims := defaultTestClaims()
+	claims.ID = "token-1"
+	token := signTestToken(key, claims)
+	if got := serveWithToken(h, token); got != 200 {
+		t.Fatalf("unexpected status %d", got)
+	}
+
+	revoke := func(body string) int {
+		rr := httptest.NewRecorder()
+		admin.ServeHTTP(rr, httptest.NewRequest("POST", "/revocations", strings.NewReader(body)))
+		return rr.Code
+	}
+	if got := revoke(`{"jti":"token-1"}`); got != 204 {
+		t.Fatalf("unexpected status %d", got)
+	}
+	if got := serveWithToken(h, token); got != 401 {
+		t.Errorf("revoked jti: unexpected status %d", got)
+	}
+
+	other := defaultTestClaims()
+	other.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	if got := serveWithToken(h, signTestToken(key, other)); got != 200 {
+		t.Fatalf("unexpected status %d", got)
+	}
+	if got := revoke(`{"sub":"user-id","issued_before":"` + time.Now().Add(-time.Second).Format(time.RFC3339) + `"}`); got != 204 {
+		t.Fatalf("unexpected status %d", got)
+	}
+	if got := serveWithToken(h, signTestToken(key, other)); got != 401 {
+		t.Errorf("revoked subject: unexpected status %d", got)
+	}
+	fresh := defaultTestClaims()
+	fresh.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Second))
+	if got := serveWithToken(h, signTestToken(key, fresh)); got != 200 {
+		t.Errorf("token issued after revocation: unexpected status %d", got)
+	}
+	if got := revoke(`{"jti":"a","sub":"b"}`); got != 400 {
+		t.Errorf("unexpected status %d", got)
+	}
+}
+
+func TestFileRevocationStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "revoked.json")
+
+	s, err := NewFileRevocationStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeToken("jti-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeSubject("user-1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFileRevocationStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := reloaded.IsRevoked("jti-1", "", time.Time{}); !revoked {
+		t.Error("expected jti to stay revoked after reload")
+	}
+	if revoked, _ := reloaded.IsRevoked("", "user-1", time.Now().Add(-time.Minute)); !revoked {
+		t.Error("expected subject to stay revoked after reload")
+	}
+	if revoked, _ := reloaded.IsRevoked("jti-2", "user-2", time.Now()); revoked {
+		t.Error("unexpected revocation")
+	}
+}
+
+func TestMemoryRevocationStoreEviction(t *testing.T) {
+	s := NewMemoryRevocationStore(time.Millisecond)
+	s.RevokeToken("expired", time.Now().Add(-time.Second))
+	s.RevokeSubject("user", time.Now())
+	time.Sleep(2 * time.Millisecond)
+	if revoked, _ := s.IsRevoked("expired", "user", time.Time{}); revoked {
+		t.Error("expected expired entries to be ignored")
+	}
+	s.lastSweep = time.Time{}
+	s.RevokeToken("other", time.Time{})
+	if len(s.tokens) != 1 || len(s.subjects) != 0 {
+		t.Errorf("expected expired entries to be evicted, got %v %v", s.tokens, s.subjects)
+	}
+}
+
+func TestRevokeSubjectSecondPrecision(t *testing.T) {
+	s := NewMemoryRevocationStore(time.Hour)
+	before := time.Now().Truncate(time.Second).Add(500 * time.Millisecond)
+	s.RevokeSubject("user", before)
+	var tests = []struct {
+		name     string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"issued the second before", before.Truncate(time.Second).Add(-time.Second), true},
+		{"issued in the same second", before.Truncate(time.Second), false},
+		{"issued after", before.Add(time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if revoked, _ := s.IsRevoked("", "user", tt.issuedAt); revoked != tt.want {
+				t.Errorf("unexpected revoked %v, want %v", revoked, tt.want)
+			}
+		})
+	}
+}
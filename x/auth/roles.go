@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrRoleCycle returned when role inheritance is not acyclic
+var ErrRoleCycle = errors.New("role hierarchy has a cycle")
+
+// RoleHierarchy role inheritance, a role implies every role reachable from it
+type RoleHierarchy struct {
+	implied map[string][]string
+}
+
+// NewRoleHierarchy create RoleHierarchy from role to directly implied roles,
+// e.g. {"admin": {"editor"}, "editor": {"viewer"}}. Return ErrRoleCycle when
+// inheritance is not a DAG
+func NewRoleHierarchy(inherits map[string][]string) (*RoleHierarchy, error) {
+	// sorted traversal so the reported cycle is stable
+	roles := make([]string, 0, len(inherits))
+	for role := range inherits {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	implied := map[string][]string{}
+	var visit func(role string, path []string) error
+	visit = func(role string, path []string) error {
+		switch state[role] {
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrRoleCycle, strings.Join(append(path, role), " -> "))
+		case done:
+			return nil
+		}
+		state[role] = visiting
+		set := map[string]bool{}
+		for _, child := range inherits[role] {
+			if err := visit(child, append(path, role)); err != nil {
+				return err
+			}
+			set[child] = true
+			for _, r := range implied[child] {
+				set[r] = true
+			}
+		}
+		state[role] = done
+		if len(set) > 0 {
+			implied[role] = sortedSet(set)
+		}
+		return nil
+	}
+	for _, role := range roles {
+		if err := visit(role, nil); err != nil {
+			return nil, err
+		}
+	}
+	return &RoleHierarchy{implied: implied}, nil
+}
+
+// Implied return roles implied by role, excluding role itself
+func (h *RoleHierarchy) Implied(role string) []string {
+	if h == nil {
+		return nil
+	}
+	return h.implied[role]
+}
+
+// expand add implied roles to roles
+func (h *RoleHierarchy) expand(roles map[string]string) map[string]string {
+	if h == nil {
+		return roles
+	}
+	for role := range roles {
+		for _, r := range h.implied[role] {
+			roles[r] = r
+		}
+	}
+	return roles
+}
+
+func sortedSet(set map[string]bool) []string {
+	values := make([]string, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
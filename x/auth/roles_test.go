@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestNewRoleHierarchy(t *testing.T) {
+	h, err := NewRoleHierarchy(map[string][]string{
+		"admin":  {"editor", "billing"},
+		"editor": {"viewer"},
+		"owner":  {"admin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Implied("owner"); !reflect.DeepEqual(got, []string{"admin", "billing", "editor", "viewer"}) {
+		t.Errorf("unexpected implied roles %v", got)
+	}
+	if got := h.Implied("viewer"); got != nil {
+		t.Errorf("unexpected implied roles %v", got)
+	}
+
+	_, err = NewRoleHierarchy(map[string][]string{
+		"admin":  {"editor"},
+		"editor": {"viewer"},
+		"viewer": {"admin"},
+	})
+	if !errors.Is(err, ErrRoleCycle) {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+	if err.Error() != "role hierarchy has a cycle: admin -> editor -> viewer -> admin" {
+		t.Errorf("unexpected error message %q", err)
+	}
+}
+
+func TestRoleHierarchyAppliedOnExtraction(t *testing.T) {
+	h, err := NewRoleHierarchy(map[string][]string{"admin": {"editor"}, "editor": {"viewer"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{
+		Issuer:            defaultIssuer,
+		Audiences:         defaultAudience,
+		IdentityServerURI: ts.URL,
+		RoleHierarchy:     h,
+	})
+	admin := signTestToken(key, defaultTestClaims(), map[string]interface{}{"role": "admin"})
+	editor := signTestToken(key, defaultTestClaims(), map[string]interface{}{"role": "editor"})
+	var tests = []struct {
+		name  string
+		token string
+		mw    []string
+		want  int
+	}{
+		{"admin implies viewer", admin, []string{"viewer"}, 200},
+		{"editor implies viewer", editor, []string{"viewer"}, 200},
+		{"editor is not admin", editor, []string{"admin"}, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := am.Authenticate()(RequireRoles(tt.mw...)(okHandler))
+			if got := serveWithToken(h, tt.token); got != tt.want {
+				t.Errorf("unexpected status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireAllRoles(t *testing.T) {
+	roles := map[string]string{"editor": "editor", "billing": "billing"}
+	var tests = []struct {
+		name  string
+		roles []string
+		want  int
+	}{
+		{"all granted", []string{"editor", "billing"}, 200},
+		{"missing one", []string{"editor", "admin"}, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(context.WithValue(req.Context(), RolesKey, roles))
+			rr := httptest.NewRecorder()
+			RequireAllRoles(tt.roles...)(okHandler).ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("unexpected status %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+	rr := httptest.NewRecorder()
+	RequireAllRoles("editor")(okHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != 401 {
+		t.Errorf("unexpected status %d for anonymous request", rr.Code)
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// RequireScopes allow request when token granted all of the given scopes
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return RequireAllScopes(scopes...)
+}
+
+// RequireAllScopes allow request when token granted all of the given scopes
+func RequireAllScopes(scopes ...string) func(http.Handler) http.Handler {
+	return requireScopes(scopes, func(granted map[string]string) bool {
+		for _, s := range scopes {
+			if _, ok := granted[s]; !ok {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireAnyScope allow request when token granted at least one of the given scopes
+func RequireAnyScope(scopes ...string) func(http.Handler) http.Handler {
+	return requireScopes(scopes, func(granted map[string]string) bool {
+		for _, s := range scopes {
+			if _, ok := granted[s]; ok {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func requireScopes(scopes []string, allowed func(map[string]string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !allowed(GetScopesFromContext(r.Context())) {
+				respond(w, r, errInsufficientScope("", scopes...))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetScopesFromContext return scopes granted to the authenticated token
+func GetScopesFromContext(ctx context.Context) map[string]string {
+	scopes, ok := ctx.Value(ScopesKey).(map[string]string)
+	if !ok {
+		return map[string]string{}
+	}
+	return scopes
+}
+
+// getScopesFromClaims merge space-delimited "scope" and "scp" claims (string or array form)
+func getScopesFromClaims(claims map[string]interface{}) map[string]string {
+	scopes := map[string]string{}
+	for _, name := range []string{"scope", "scp"} {
+		switch v := claims[name].(type) {
+		case string:
+			for _, s := range strings.Fields(v) {
+				scopes[s] = s
+			}
+		case []interface{}:
+			for _, s := range v {
+				if ss, ok := s.(string); ok {
+					scopes[ss] = ss
+				}
+			}
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetScopesFromClaims(t *testing.T) {
+	claims := map[string]interface{}{
+		"scope": "read:users write:users",
+		"scp":   []interface{}{"admin", "read:users"},
+	}
+	scopes := getScopesFromClaims(claims)
+	for _, s := range []string{"read:users", "write:users", "admin"} {
+		if _, ok := scopes[s]; !ok {
+			t.Errorf("expected scope %q in %v", s, scopes)
+		}
+	}
+	if len(scopes) != 3 {
+		t.Errorf("unexpected scopes %v", scopes)
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	granted := map[string]string{"read": "read", "write": "write"}
+	var tests = []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		want       int
+	}{
+		{"all granted", RequireScopes("read", "write"), 200},
+		{"all missing one", RequireAllScopes("read", "delete"), 403},
+		{"any granted", RequireAnyScope("delete", "write"), 200},
+		{"any missing", RequireAnyScope("delete"), 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(context.WithValue(req.Context(), ScopesKey, granted))
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("unexpected status %d, want %d", rr.Code, tt.want)
+			}
+			if tt.want == 403 && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate challenge")
+			}
+		})
+	}
+}
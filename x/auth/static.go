@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/flyznex/gois"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// ErrNoStaticKey returned when no configured key verify the token
+var ErrNoStaticKey = errors.New("no static key verify the token")
+
+// StaticKeys SecretProvider over a fixed set of keys. The key is looked up by kid,
+// tokens without a known kid are checked against every key.
+type StaticKeys struct {
+	keys []jose.JSONWebKey
+}
+
+// NewStaticKeys create StaticKeys
+func NewStaticKeys(keys ...jose.JSONWebKey) *StaticKeys {
+	return &StaticKeys{keys: keys}
+}
+
+// NewHMACKeys create StaticKeys for a HS256/HS384/HS512 shared secret
+func NewHMACKeys(secret []byte) *StaticKeys {
+	return NewStaticKeys(jose.JSONWebKey{Key: secret})
+}
+
+// GetSecret implements gois.SecretProvider
+func (s *StaticKeys) GetSecret(token *jwt.JSONWebToken) (interface{}, error) {
+	if len(token.Headers) < 1 {
+		return nil, gois.ErrNoJWTHeaders
+	}
+	if k, ok := findKey(s.keys, token.Headers[0].KeyID); ok {
+		return k, nil
+	}
+	for _, k := range s.keys {
+		if err := token.Claims(k); err == nil {
+			return k, nil
+		}
+	}
+	return nil, ErrNoStaticKey
+}
+
+// ParsePublicKeysPEM parse PUBLIC KEY, RSA PUBLIC KEY and CERTIFICATE blocks.
+// Key ids are set to the base64url SHA-256 thumbprint of each key.
+func ParsePublicKeysPEM(data []byte) ([]jose.JSONWebKey, error) {
+	var keys []jose.JSONWebKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var (
+			pub interface{}
+			err error
+		)
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				pub = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		key := jose.JSONWebKey{Key: pub, Use: "sig"}
+		tp, err := key.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		key.KeyID = base64.RawURLEncoding.EncodeToString(tp)
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("auth: no public key found in PEM data")
+	}
+	return keys, nil
+}
+
+// LoadJWKSFile read public keys of a local JWKS file
+func LoadJWKSFile(path string) ([]jose.JSONWebKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	jwks := gois.JWKS{}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("auth: parse %s: %v", path, err)
+	}
+	if len(jwks.Keys) == 0 {
+		return nil, fmt.Errorf("auth: no key in %s", path)
+	}
+	keys := make([]jose.JSONWebKey, 0, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		keys = append(keys, k.Public())
+	}
+	return keys, nil
+}
+
+// staticKeys build offline key provider from config, nil when config use a remote JWKS
+func staticKeys(cfg ConfigAuth) (*StaticKeys, error) {
+	var keys []jose.JSONWebKey
+	if cfg.PublicKeysPEM != "" {
+		k, err := ParsePublicKeysPEM([]byte(cfg.PublicKeysPEM))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k...)
+	}
+	if cfg.JWKSFile != "" {
+		k, err := LoadJWKSFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k...)
+	}
+	if cfg.HMACSecret != "" {
+		if len(keys) > 0 {
+			return nil, errors.New("auth: HMACSecret cannot be combined with public keys")
+		}
+		return NewHMACKeys([]byte(cfg.HMACSecret)), nil
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return NewStaticKeys(keys...), nil
+}
+
+// allowAlgorithms restrict token algorithm to the given list
+func allowAlgorithms(algs ...jose.SignatureAlgorithm) func(alg string) error {
+	return func(alg string) error {
+		for _, a := range algs {
+			if string(a) == alg {
+				return nil
+			}
+		}
+		return gois.ErrInvalidAlgorithm
+	}
+}
+
+var (
+	hmacAlgorithms       = []jose.SignatureAlgorithm{jose.HS256, jose.HS384, jose.HS512}
+	asymmetricAlgorithms = []jose.SignatureAlgorithm{
+		jose.RS256, jose.RS384, jose.RS512,
+		jose.PS256, jose.PS384, jose.PS512,
+		jose.ES256, jose.ES384, jose.ES512,
+		jose.EdDSA,
+	}
+)
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	auth0 "github.com/auth0-community/go-auth0"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestOfflineVerification(t *testing.T) {
+	rsKey := genRSASSAJWK(jose.RS256, "rs")
+	esKey := genECDSAJWK(jose.ES384, "es")
+	der, err := x509.MarshalPKIXPublicKey(rsKey.Public().Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jwksFile := filepath.Join(dir, "jwks.json")
+	data, _ := json.Marshal(auth0.JWKS{Keys: []jose.JSONWebKey{esKey.Public()}})
+	if err := ioutil.WriteFile(jwksFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	secret := jose.JSONWebKey{Key: []byte("0123456789abcdef0123456789abcdef"), KeyID: "hs", Algorithm: string(jose.HS256)}
+	wrongSecret := jose.JSONWebKey{Key: []byte("wrong-secret-wrong-secret-wrong!"), Algorithm: string(jose.HS256)}
+
+	var tests = []struct {
+		name   string
+		cfg    ConfigAuth
+		token  string
+		status int
+	}{
+		{"pem", ConfigAuth{PublicKeysPEM: string(pemData)}, signTestToken(rsKey, defaultTestClaims()), 200},
+		{"pem wrong key", ConfigAuth{PublicKeysPEM: string(pemData)}, signTestToken(esKey, defaultTestClaims()), 401},
+		{"jwks file", ConfigAuth{JWKSFile: jwksFile}, signTestToken(esKey, defaultTestClaims()), 200},
+		{"hmac", ConfigAuth{HMACSecret: string(secret.Key.([]byte))}, signTestToken(secret, defaultTestClaims()), 200},
+		{"hmac wrong secret", ConfigAuth{HMACSecret: string(secret.Key.([]byte))}, signTestToken(wrongSecret, defaultTestClaims()), 401},
+		{"hmac asymmetric token", ConfigAuth{HMACSecret: string(secret.Key.([]byte))}, signTestToken(rsKey, defaultTestClaims()), 401},
+		{"broken config", ConfigAuth{PublicKeysPEM: "garbage"}, signTestToken(rsKey, defaultTestClaims()), 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Issuer, tt.cfg.Audiences = defaultIssuer, defaultAudience
+			handlers := map[string]http.Handler{
+				"AuthManager":   NewAuthManager(tt.cfg).Authenticate()(okHandler),
+				"Authenticator": Authenticator(New(tt.cfg))(okHandler),
+			}
+			for name, h := range handlers {
+				if got := serveWithToken(h, tt.token); got != tt.status {
+					t.Errorf("%s: unexpected status %d", name, got)
+				}
+			}
+		})
+	}
+
+	if _, err := NewMultiIssuerAuthManager(ConfigAuth{Issuer: "a", PublicKeysPEM: "garbage"}); err == nil {
+		t.Error("expected invalid PEM error")
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+var (
+	// ErrTokenTooOld returned when token was issued longer than MaxAge ago
+	ErrTokenTooOld = errors.New("token is too old")
+	// ErrMissingClaim returned when a required claim is not set
+	ErrMissingClaim = errors.New("missing required claim")
+)
+
+// skipTimeLeeway disable time checks of the gois validator, exp, nbf and iat
+// are checked by temporalRules with the configured clock and leeway
+const skipTimeLeeway = 100 * 365 * 24 * time.Hour
+
+// temporalRules time and presence checks applied to validated claims
+type temporalRules struct {
+	leeway   time.Duration
+	maxAge   time.Duration
+	required []string
+	now      func() time.Time
+}
+
+func newTemporalRules(cfg ConfigAuth) temporalRules {
+	t := temporalRules{
+		leeway:   cfg.Leeway,
+		maxAge:   cfg.MaxAge,
+		required: cfg.RequiredClaims,
+		now:      cfg.Clock,
+	}
+	if t.leeway == 0 {
+		t.leeway = jwt.DefaultLeeway
+	} else if t.leeway < 0 {
+		t.leeway = 0
+	}
+	if t.now == nil {
+		t.now = time.Now
+	}
+	return t
+}
+
+// validate check exp, nbf, iat and required claims
+func (t temporalRules) validate(claims map[string]interface{}) error {
+	for _, name := range t.required {
+		if v, ok := claims[name]; !ok || v == nil || v == "" {
+			return fmt.Errorf("%w %s", ErrMissingClaim, name)
+		}
+	}
+	now := t.now()
+	if exp := timeClaim(claims, "exp"); !exp.IsZero() && now.Add(-t.leeway).After(exp) {
+		return jwt.ErrExpired
+	}
+	if nbf := timeClaim(claims, "nbf"); !nbf.IsZero() && now.Add(t.leeway).Before(nbf) {
+		return jwt.ErrNotValidYet
+	}
+	iat := timeClaim(claims, "iat")
+	if !iat.IsZero() && now.Add(t.leeway).Before(iat) {
+		return jwt.ErrIssuedInTheFuture
+	}
+	if t.maxAge > 0 && (iat.IsZero() || now.Add(-t.leeway).Sub(iat) > t.maxAge) {
+		return ErrTokenTooOld
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestTemporalValidation(t *testing.T) {
+	key := genRSASSAJWK(jose.RS256, "key")
+	ts := newTestJWKSServer(key)
+	defer ts.Close()
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	claims := func(iat, nbf, exp time.Duration) jwt.Claims {
+		c := jwt.Claims{
+			Issuer:   defaultIssuer,
+			Audience: defaultAudience,
+			Subject:  "user-id",
+			ID:       "token-id",
+			IssuedAt: jwt.NewNumericDate(now.Add(iat)),
+			Expiry:   jwt.NewNumericDate(now.Add(exp)),
+		}
+		if nbf != 0 {
+			c.NotBefore = jwt.NewNumericDate(now.Add(nbf))
+		}
+		return c
+	}
+	noJTI := claims(-time.Minute, 0, time.Hour)
+	noJTI.ID = ""
+	var tests = []struct {
+		name   string
+		cfg    ConfigAuth
+		claims jwt.Claims
+		want   int
+	}{
+		{"valid at injected clock", ConfigAuth{}, claims(-time.Minute, 0, time.Hour), 200},
+		{"expired", ConfigAuth{}, claims(-2*time.Hour, 0, -2*time.Minute), 401},
+		{"expired within leeway", ConfigAuth{Leeway: 5 * time.Minute}, claims(-2*time.Hour, 0, -2*time.Minute), 200},
+		{"expired without leeway", ConfigAuth{Leeway: -1}, claims(-2*time.Hour, 0, -time.Second), 401},
+		{"not valid yet", ConfigAuth{}, claims(-time.Minute, 10*time.Minute, time.Hour), 401},
+		{"nbf within leeway", ConfigAuth{Leeway: 15 * time.Minute}, claims(-time.Minute, 10*time.Minute, time.Hour), 200},
+		{"issued in the future", ConfigAuth{}, claims(10*time.Minute, 0, time.Hour), 401},
+		{"max age", ConfigAuth{MaxAge: 30 * time.Minute}, claims(-time.Minute, 0, time.Hour), 200},
+		{"too old", ConfigAuth{MaxAge: 30 * time.Minute}, claims(-45*time.Minute, 0, time.Hour), 401},
+		{"required claims", ConfigAuth{RequiredClaims: []string{"sub", "jti"}}, claims(-time.Minute, 0, time.Hour), 200},
+		{"missing required claim", ConfigAuth{RequiredClaims: []string{"sub", "jti"}}, noJTI, 401},
+		{"missing required nbf", ConfigAuth{RequiredClaims: []string{"nbf"}}, claims(-time.Minute, 0, time.Hour), 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Issuer = defaultIssuer
+			cfg.Audiences = defaultAudience
+			cfg.IdentityServerURI = ts.URL
+			cfg.Clock = clock
+			handlers := map[string]http.Handler{
+				"AuthManager":   NewAuthManager(cfg).Authenticate()(okHandler),
+				"Authenticator": Authenticator(New(cfg))(okHandler),
+			}
+			for name, h := range handlers {
+				if got := serveWithToken(h, signTestToken(key, tt.claims)); got != tt.want {
+					t.Errorf("%s: unexpected status %d, want %d", name, got, tt.want)
+				}
+			}
+		})
+	}
+}
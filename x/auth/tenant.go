@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// TenantOptions configure RequireTenant. The route tenant is read from the chi
+// URL param Param, or the request header Header when the param is not set
+type TenantOptions struct {
+	Param  string
+	Header string
+	// SuperuserRole role allowed to access every tenant, disabled when empty
+	SuperuserRole string
+}
+
+// RequireTenant middleware store the tenant of the request in context and reject
+// requests whose route tenant differ from the tenant claim of the token. Callers
+// with SuperuserRole act on the route tenant. Mount it with chi Router.With or
+// inside a route so URL params are resolved
+func RequireTenant(opts TenantOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		hfn := func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				respond(w, r, errMissingToken())
+				return
+			}
+			tenant := routeTenant(r, opts)
+			superuser := opts.SuperuserRole != "" && p.HasRole(opts.SuperuserRole)
+			switch {
+			case superuser && tenant == "":
+				tenant = p.Tenant
+			case superuser:
+			case p.Tenant == "":
+				respond(w, r, errInsufficientScope("token has no tenant"))
+				return
+			case tenant != "" && tenant != p.Tenant:
+				respond(w, r, errInsufficientScope("tenant mismatch"))
+				return
+			default:
+				tenant = p.Tenant
+			}
+			ctx := r.Context()
+			if tenant != "" {
+				ctx = context.WithValue(ctx, TenantKey, tenant)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(hfn)
+	}
+}
+
+// TenantFromContext return tenant stored by RequireTenant
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(TenantKey).(string)
+	return tenant, ok && tenant != ""
+}
+
+func routeTenant(r *http.Request, opts TenantOptions) string {
+	if opts.Param != "" {
+		if tenant := chi.URLParam(r, opts.Param); tenant != "" {
+			return tenant
+		}
+	}
+	if opts.Header != "" {
+		return r.Header.Get(opts.Header)
+	}
+	return ""
+}
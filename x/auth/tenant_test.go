@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+func TestRequireTenant(t *testing.T) {
+	var got string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		got, _ = TenantFromContext(r.Context())
+	}
+	r := chi.NewRouter()
+	opts := TenantOptions{Param: "tenant", Header: "X-Tenant", SuperuserRole: "root"}
+	r.With(RequireTenant(opts)).Get("/tenants/{tenant}/items", h)
+	r.With(RequireTenant(opts)).Get("/items", h)
+
+	acme := map[string]interface{}{"sub": "1", "tenant": "acme"}
+	root := map[string]interface{}{"sub": "2", "role": "root"}
+	var tests = []struct {
+		name       string
+		path       string
+		header     string
+		claims     map[string]interface{}
+		want       int
+		wantTenant string
+	}{
+		{"anonymous", "/tenants/acme/items", "", nil, 401, ""},
+		{"same tenant param", "/tenants/acme/items", "", acme, 200, "acme"},
+		{"other tenant param", "/tenants/globex/items", "", acme, 403, ""},
+		{"same tenant header", "/items", "acme", acme, 200, "acme"},
+		{"other tenant header", "/items", "globex", acme, 403, ""},
+		{"no route tenant", "/items", "", acme, 200, "acme"},
+		{"no tenant claim", "/tenants/acme/items", "", map[string]interface{}{"sub": "3"}, 403, ""},
+		{"superuser", "/tenants/globex/items", "", root, 200, "globex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Tenant", tt.header)
+			}
+			if tt.claims != nil {
+				req = req.WithContext(contextWithClaims(context.Background(), tt.claims, claimMapping{}))
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("unexpected status %d, want %d", rr.Code, tt.want)
+			}
+			if got != tt.wantTenant {
+				t.Errorf("unexpected tenant %q, want %q", got, tt.wantTenant)
+			}
+		})
+	}
+}
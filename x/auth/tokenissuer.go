@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/flyznex/gois"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// DefaultTokenTTL lifetime of tokens minted by TokenIssuer
+const DefaultTokenTTL = 5 * time.Minute
+
+// TokenIssuer sign short-lived JWTs and publish the public keys as JWKS.
+// Rotated keys stay published until retired so tokens signed with them still verify.
+type TokenIssuer struct {
+	issuer string
+	ttl    time.Duration
+
+	mu        sync.RWMutex
+	current   jose.JSONWebKey
+	signer    jose.Signer
+	published []jose.JSONWebKey
+}
+
+// GenerateSigningKey generate private key for RS*, PS*, ES* or EdDSA algorithms.
+// kid defaults to the base64url SHA-256 thumbprint of the key.
+func GenerateSigningKey(alg jose.SignatureAlgorithm, kid string) (jose.JSONWebKey, error) {
+	var (
+		key interface{}
+		err error
+	)
+	switch alg {
+	case jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jose.ES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jose.ES384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case jose.ES512:
+		key, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case jose.EdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return jose.JSONWebKey{}, fmt.Errorf("auth: unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	jwk := jose.JSONWebKey{Key: key, KeyID: kid, Algorithm: string(alg), Use: "sig"}
+	if kid == "" {
+		pub := jwk.Public()
+		tp, err := pub.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return jose.JSONWebKey{}, err
+		}
+		jwk.KeyID = base64.RawURLEncoding.EncodeToString(tp)
+	}
+	return jwk, nil
+}
+
+// NewTokenIssuer create TokenIssuer signing with a private key, key.Algorithm
+// and key.KeyID are required. ttl defaults to DefaultTokenTTL.
+func NewTokenIssuer(issuer string, ttl time.Duration, key jose.JSONWebKey) (*TokenIssuer, error) {
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+	ti := &TokenIssuer{issuer: issuer, ttl: ttl}
+	if err := ti.Rotate(key); err != nil {
+		return nil, err
+	}
+	return ti, nil
+}
+
+// Rotate sign new tokens with key, the previous key stays published until Retire
+func (ti *TokenIssuer) Rotate(key jose.JSONWebKey) error {
+	if key.IsPublic() {
+		return errors.New("auth: token issuer needs a private key")
+	}
+	if key.KeyID == "" || key.Algorithm == "" {
+		return errors.New("auth: token issuer key needs kid and alg")
+	}
+	opts := (&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", key.KeyID)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key}, opts)
+	if err != nil {
+		return err
+	}
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.current, ti.signer = key, signer
+	for _, k := range ti.published {
+		if k.KeyID == key.KeyID {
+			return nil
+		}
+	}
+	ti.published = append(ti.published, key.Public())
+	return nil
+}
+
+// Retire stop publishing key, the current signing key cannot be retired
+func (ti *TokenIssuer) Retire(kid string) error {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if kid == ti.current.KeyID {
+		return errors.New("auth: cannot retire current signing key")
+	}
+	keys := ti.published[:0]
+	for _, k := range ti.published {
+		if k.KeyID != kid {
+			keys = append(keys, k)
+		}
+	}
+	ti.published = keys
+	return nil
+}
+
+// Issue sign a token for subject and audience. iss, sub, aud, iat, nbf, exp and jti
+// are set by the issuer, extra claims are merged in order.
+func (ti *TokenIssuer) Issue(subject string, audience []string, claims ...interface{}) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	std := jwt.Claims{
+		Issuer:    ti.issuer,
+		Subject:   subject,
+		Audience:  audience,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Expiry:    jwt.NewNumericDate(now.Add(ti.ttl)),
+		ID:        base64.RawURLEncoding.EncodeToString(jti),
+	}
+	ti.mu.RLock()
+	builder := jwt.Signed(ti.signer)
+	ti.mu.RUnlock()
+	for _, c := range claims {
+		builder = builder.Claims(c)
+	}
+	return builder.Claims(std).CompactSerialize()
+}
+
+// JWKS return published public keys
+func (ti *TokenIssuer) JWKS() gois.JWKS {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	keys := make([]jose.JSONWebKey, len(ti.published))
+	copy(keys, ti.published)
+	return gois.JWKS{Keys: keys}
+}
+
+// JWKSHandler serve published public keys, use its URL as IdentityServerURI of AuthManager
+func (ti *TokenIssuer) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Cache-Control", "max-age=300")
+		json.NewEncoder(w).Encode(ti.JWKS())
+	})
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestTokenIssuer(t *testing.T) {
+	for _, alg := range []jose.SignatureAlgorithm{jose.RS256, jose.ES256, jose.EdDSA} {
+		t.Run(string(alg), func(t *testing.T) {
+			key, err := GenerateSigningKey(alg, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ti, err := NewTokenIssuer(defaultIssuer, time.Minute, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts := httptest.NewServer(ti.JWKSHandler())
+			defer ts.Close()
+			am := NewAuthManager(ConfigAuth{
+				Issuer:            defaultIssuer,
+				Audiences:         defaultAudience,
+				IdentityServerURI: ts.URL,
+				MethodSignature:   string(alg),
+			})
+			token, err := ti.Issue("service-a", defaultAudience, map[string]interface{}{"role": "service"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := serveWithToken(am.Authenticate()(RequireRoles("service")(okHandler)), token); got != 200 {
+				t.Errorf("unexpected status %d", got)
+			}
+		})
+	}
+}
+
+func TestTokenIssuerRotation(t *testing.T) {
+	k1, _ := GenerateSigningKey(jose.RS256, "k1")
+	k2, _ := GenerateSigningKey(jose.RS256, "k2")
+	ti, err := NewTokenIssuer(defaultIssuer, time.Minute, k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _ := ti.Issue("service-a", defaultAudience)
+	if err := ti.Rotate(k2); err != nil {
+		t.Fatal(err)
+	}
+	current, _ := ti.Issue("service-a", defaultAudience)
+	if err := ti.Retire("k2"); err == nil {
+		t.Error("expected current key retirement to fail")
+	}
+	if got := len(ti.JWKS().Keys); got != 2 {
+		t.Fatalf("expected both keys published, got %d", got)
+	}
+
+	ts := httptest.NewServer(ti.JWKSHandler())
+	defer ts.Close()
+	am := NewAuthManager(ConfigAuth{Issuer: defaultIssuer, Audiences: defaultAudience, IdentityServerURI: ts.URL})
+	h := am.Authenticate()(okHandler)
+	if got := serveWithToken(h, old); got != 200 {
+		t.Errorf("old token: unexpected status %d", got)
+	}
+	if got := serveWithToken(h, current); got != 200 {
+		t.Errorf("current token: unexpected status %d", got)
+	}
+
+	ti.Retire("k1")
+	am = NewAuthManager(ConfigAuth{Issuer: defaultIssuer, Audiences: defaultAudience, IdentityServerURI: ts.URL})
+	if got := serveWithToken(am.Authenticate()(okHandler), old); got != 401 {
+		t.Errorf("retired key: unexpected status %d", got)
+	}
+}
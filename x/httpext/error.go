@@ -17,10 +17,17 @@ type ErrorResponse struct {
 	Error string `json:"err"`
 }
 
+// StatusCoder error carrying its own HTTP status
+type StatusCoder interface {
+	StatusCode() int
+}
+
 // encode errors from business-logic
 func EncodeError(_ context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	switch err {
+	switch e := err.(type) {
+	case StatusCoder:
+		w.WriteHeader(e.StatusCode())
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
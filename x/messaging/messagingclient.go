@@ -134,6 +134,15 @@ func buildMessage(ctx context.Context, body []byte) amqp.Publishing {
 }
 
 func (c *AmqpClient) Subscribe(exchangeName string, exchangeType string, consumerName string, queueName string, routingKey string, handlerFunc func(amqp.Delivery)) error {
+	return c.subscribe(exchangeName, exchangeType, consumerName, queueName, routingKey, true, handlerFunc)
+}
+
+// SubscribeManualAck is Subscribe without auto-ack, handlerFunc must Ack, Nack or Reject every delivery
+func (c *AmqpClient) SubscribeManualAck(exchangeName string, exchangeType string, consumerName string, queueName string, routingKey string, handlerFunc func(amqp.Delivery)) error {
+	return c.subscribe(exchangeName, exchangeType, consumerName, queueName, routingKey, false, handlerFunc)
+}
+
+func (c *AmqpClient) subscribe(exchangeName string, exchangeType string, consumerName string, queueName string, routingKey string, autoAck bool, handlerFunc func(amqp.Delivery)) error {
 	if c.conn == nil {
 		return ErrNoConnection
 	}
@@ -186,7 +195,7 @@ func (c *AmqpClient) Subscribe(exchangeName string, exchangeType string, consume
 	msgs, err := ch.Consume(
 		queue.Name,   // queue
 		consumerName, // consumer
-		true,         // auto-ack
+		autoAck,      // auto-ack
 		false,        // exclusive
 		false,        // no-local
 		false,        // no-wait
@@ -199,7 +208,17 @@ func (c *AmqpClient) Subscribe(exchangeName string, exchangeType string, consume
 	go consumeLoop(msgs, handlerFunc)
 	return nil
 }
+
 func (c *AmqpClient) SubscribeToQueue(queueName string, consumerName string, handlerFunc func(amqp.Delivery)) error {
+	return c.subscribeToQueue(queueName, consumerName, true, handlerFunc)
+}
+
+// SubscribeToQueueManualAck is SubscribeToQueue without auto-ack, handlerFunc must Ack, Nack or Reject every delivery
+func (c *AmqpClient) SubscribeToQueueManualAck(queueName string, consumerName string, handlerFunc func(amqp.Delivery)) error {
+	return c.subscribeToQueue(queueName, consumerName, false, handlerFunc)
+}
+
+func (c *AmqpClient) subscribeToQueue(queueName string, consumerName string, autoAck bool, handlerFunc func(amqp.Delivery)) error {
 	if c.conn == nil {
 		return ErrNoConnection
 	}
@@ -225,7 +244,7 @@ func (c *AmqpClient) SubscribeToQueue(queueName string, consumerName string, han
 	msgs, err := ch.Consume(
 		queue.Name,   // queue
 		consumerName, // consumer
-		true,         // auto-ack
+		autoAck,      // auto-ack
 		false,        // exclusive
 		false,        // no-local
 		false,        // no-wait
@@ -106,3 +106,14 @@ func testSubscribe(am *AmqpClient) func(*testing.T) {
 		}
 	}
 }
+
+func TestSubscribeManualAckWithoutConnection(t *testing.T) {
+	c := &AmqpClient{}
+	handlerFunc := func(amqp.Delivery) {}
+	if err := c.SubscribeManualAck("test-exchange", amqp.ExchangeDirect, "consumer-name-test", "test-queue", "test-event", handlerFunc); err != ErrNoConnection {
+		t.Errorf("Expected %v, got %v", ErrNoConnection, err)
+	}
+	if err := c.SubscribeToQueueManualAck("test-queue", "consumer-name-test", handlerFunc); err != ErrNoConnection {
+		t.Errorf("Expected %v, got %v", ErrNoConnection, err)
+	}
+}